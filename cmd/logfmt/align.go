@@ -0,0 +1,153 @@
+package main
+
+import "strings"
+
+// aligner buffers a window of records and lays their fields out in
+// columns, one per key, so that output reads like a table. A record
+// missing a key leaves its column blank. A window of 0 buffers the
+// whole input.
+type aligner struct {
+	window  int
+	pending []alignedLine
+}
+
+type alignedLine struct {
+	meta   string
+	line   string
+	fields []field
+}
+
+// add buffers a record, returning the lines ready to be written.
+// Lines without fields (e.g. JSON or -error-field output) are passed
+// through unpadded, except for their -emit-meta prefix.
+func (a *aligner) add(meta, line string, fields []field) []string {
+	a.pending = append(a.pending, alignedLine{meta: meta, line: line, fields: fields})
+	if a.window == 0 || len(a.pending) < a.window {
+		return nil
+	}
+	return a.flush()
+}
+
+// flush pads and returns all buffered lines.
+func (a *aligner) flush() []string {
+	widths := make(map[string]int)
+	metaWidth := 0
+	var cols alignColumns
+	for _, l := range a.pending {
+		if w := displayWidth(l.meta); w > metaWidth {
+			metaWidth = w
+		}
+		cols.add(l.fields)
+		for _, f := range l.fields {
+			w := f.width()
+			if w > widths[f.key] {
+				widths[f.key] = w
+			}
+		}
+	}
+
+	lines := make([]string, 0, len(a.pending))
+	for _, l := range a.pending {
+		var b strings.Builder
+		if metaWidth > 0 {
+			b.WriteString(l.meta)
+			b.WriteString(strings.Repeat(" ", metaWidth-displayWidth(l.meta)+1))
+		}
+		if l.fields == nil {
+			b.WriteString(l.line)
+			lines = append(lines, b.String())
+			continue
+		}
+
+		if cols.ordered(l.fields) {
+			writeColumns(&b, l.fields, cols.keys, widths)
+		} else {
+			writePadded(&b, l.fields, widths)
+		}
+		lines = append(lines, b.String())
+	}
+
+	a.pending = a.pending[:0]
+	return lines
+}
+
+// writeColumns writes fields in the column of their key, padding the
+// columns of keys the record doesn't have. Nothing is written after a
+// record's last field.
+func writeColumns(b *strings.Builder, fields []field, keys []string, widths map[string]int) {
+	next := 0
+	pad := 0
+	for _, key := range keys {
+		if next == len(fields) {
+			break
+		}
+		if next > 0 || pad > 0 {
+			pad++
+		}
+		if fields[next].key != key {
+			pad += widths[key]
+			continue
+		}
+		f := fields[next]
+		b.WriteString(strings.Repeat(" ", pad))
+		b.WriteString(f.pair())
+		pad = widths[key] - f.width()
+		next++
+	}
+}
+
+// writePadded writes fields in their own order, padding each to the
+// width of its key. It's used for a record whose fields are ordered
+// differently from the columns.
+func writePadded(b *strings.Builder, fields []field, widths map[string]int) {
+	for i, f := range fields {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(f.pair())
+		if i < len(fields)-1 {
+			b.WriteString(strings.Repeat(" ", widths[f.key]-f.width()))
+		}
+	}
+}
+
+// alignColumns is the column order of a window: every key seen, with
+// a key first seen in a later record placed after the key preceding
+// it there.
+type alignColumns struct {
+	keys  []string
+	index map[string]int
+}
+
+func (c *alignColumns) add(fields []field) {
+	if c.index == nil {
+		c.index = make(map[string]int)
+	}
+	prev := -1
+	for _, f := range fields {
+		if i, ok := c.index[f.key]; ok {
+			prev = i
+			continue
+		}
+		prev++
+		c.keys = append(c.keys, "")
+		copy(c.keys[prev+1:], c.keys[prev:])
+		c.keys[prev] = f.key
+		for i := prev; i < len(c.keys); i++ {
+			c.index[c.keys[i]] = i
+		}
+	}
+}
+
+// ordered reports whether fields appear in column order.
+func (c *alignColumns) ordered(fields []field) bool {
+	prev := -1
+	for _, f := range fields {
+		i := c.index[f.key]
+		if i <= prev {
+			return false
+		}
+		prev = i
+	}
+	return true
+}
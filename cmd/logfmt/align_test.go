@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAlignWideCharacters(t *testing.T) {
+	records := [][]field{
+		{{key: "msg", value: "hello"}, {key: "user", value: "bob"}, {key: "n", value: "1"}},
+		{{key: "msg", value: "日本語"}, {key: "user", value: "太郎"}, {key: "n", value: "2"}},
+		{{key: "msg", value: "café"}, {key: "user", value: "ｈｉ"}, {key: "n", value: "3"}},
+		{{key: "msg", value: "x"}, {key: "n", value: "4"}},
+	}
+
+	a := &aligner{}
+	for _, fields := range records {
+		var pairs []string
+		for _, f := range fields {
+			pairs = append(pairs, f.pair())
+		}
+		a.add("", strings.Join(pairs, " "), fields)
+	}
+	lines := a.flush()
+
+	// every key starts in the same display column on every line
+	want := map[string]int{"msg": 0, "user": 11, "n": 21}
+	for i, l := range lines {
+		for _, f := range records[i] {
+			idx := strings.Index(l, f.key+"=")
+			if idx < 0 {
+				t.Fatalf("line %q has no %s", l, f.key)
+			}
+			if col := displayWidth(l[:idx]); col != want[f.key] {
+				t.Errorf("line %d %q: %s at column %d, want %d", i, l, f.key, col, want[f.key])
+			}
+		}
+	}
+}
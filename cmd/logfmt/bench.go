@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"time"
+)
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	*c.n += int64(n)
+	return n, err
+}
+
+// benchRun tracks the cost of a -bench run.
+type benchRun struct {
+	// bytes is the total read through the readers returned by wrap.
+	bytes   int64
+	start   time.Time
+	mallocs uint64
+}
+
+func startBench() *benchRun {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return &benchRun{
+		start:   time.Now(),
+		mallocs: m.Mallocs,
+	}
+}
+
+// wrap returns r counting the bytes read into b.
+func (b *benchRun) wrap(r io.Reader) io.Reader {
+	return &countingReader{r: r, n: &b.bytes}
+}
+
+func (b *benchRun) report(stats *runStats) {
+	elapsed := time.Since(b.start)
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	allocs := m.Mallocs - b.mallocs
+
+	secs := elapsed.Seconds()
+	perRecord := 0.0
+	if stats.records > 0 {
+		perRecord = float64(allocs) / float64(stats.records)
+	}
+	fmt.Fprintf(os.Stderr, "%d records, %d bytes in %s\n", stats.records, b.bytes, elapsed)
+	fmt.Fprintf(os.Stderr, "%.0f records/s %.2f MB/s\n", float64(stats.records)/secs, float64(b.bytes)/secs/1e6)
+	fmt.Fprintf(os.Stderr, "%d allocs (%.1f/record)\n", allocs, perRecord)
+}
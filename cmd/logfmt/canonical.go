@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/psanford/logfmt/convert"
+)
+
+// canonicalFields renders rec for -canonicalize: keys sorted bytewise
+// regardless of -order, strings always quoted, numbers in a normalized
+// exact form, null as null and nested values as compact JSON with
+// sorted keys. Equal records always render identically, so the result
+// is suitable for hashing.
+func canonicalFields(rec map[string]interface{}, opts convert.Options) []field {
+	keys := make([]string, 0, len(rec))
+	for k := range rec {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fields := make([]field, len(keys))
+	for i, k := range keys {
+		fields[i] = field{key: opts.FormatKey(k), value: canonicalValue(rec[k], opts)}
+	}
+	return fields
+}
+
+func canonicalValue(v interface{}, opts convert.Options) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(t)
+	case json.Number:
+		return canonicalNumber(string(t))
+	case string:
+		return opts.QuoteString(t)
+	case map[string]interface{}, []interface{}:
+		b, err := json.Marshal(canonicalJSON(t))
+		if err == nil {
+			return opts.QuoteString(string(b))
+		}
+	}
+	return opts.QuoteString(convert.PlainValue(v))
+}
+
+// canonicalJSON returns v with its numbers normalized by
+// canonicalNumber. Object keys are already sorted by json.Marshal.
+func canonicalJSON(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		return json.Number(canonicalNumber(string(t)))
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, elem := range t {
+			out[k] = canonicalJSON(elem)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, elem := range t {
+			out[i] = canonicalJSON(elem)
+		}
+		return out
+	}
+	return v
+}
+
+// canonicalNumber rewrites the JSON number s in its shortest exact
+// form, so that 1, 1.0 and 10e-1 all become 1. Small exponents are
+// written out in full and others in e notation. Unlike converting
+// through float64 no precision is lost.
+func canonicalNumber(s string) string {
+	orig := s
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	exp := 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		e, err := strconv.Atoi(s[i+1:])
+		if err != nil {
+			// an exponent too large to normalize is left as written
+			return orig
+		}
+		exp, s = e, s[:i]
+	}
+	digits := s
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		digits = s[:i] + s[i+1:]
+		exp -= len(s) - i - 1
+	}
+
+	digits = strings.TrimLeft(digits, "0")
+	trimmed := strings.TrimRight(digits, "0")
+	exp += len(digits) - len(trimmed)
+	digits = trimmed
+	if digits == "" {
+		return "0"
+	}
+
+	var out string
+	// point is where the decimal point falls relative to digits
+	point := len(digits) + exp
+	switch {
+	case exp >= 0 && point <= 21:
+		out = digits + strings.Repeat("0", exp)
+	case exp < 0 && point > 0:
+		out = digits[:point] + "." + digits[point:]
+	case exp < 0 && point > -6:
+		out = "0." + strings.Repeat("0", -point) + digits
+	default:
+		out = digits[:1]
+		if len(digits) > 1 {
+			out += "." + digits[1:]
+		}
+		out += "e" + strconv.Itoa(point-1)
+	}
+	if neg {
+		out = "-" + out
+	}
+	return out
+}
+
+// canonicalHash returns the hex SHA-256 of the canonical form of rec.
+func canonicalHash(rec map[string]interface{}, opts convert.Options) string {
+	sum := sha256.Sum256([]byte(joinFields(canonicalFields(rec, opts))))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/psanford/logfmt/convert"
+)
+
+func TestCanonicalNumber(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"1", "1"},
+		{"1.0", "1"},
+		{"10e-1", "1"},
+		{"1.50", "1.5"},
+		{"-1.50", "-1.5"},
+		{"0", "0"},
+		{"-0", "0"},
+		{"0.000", "0"},
+		{"007", "7"},
+		{"123e-2", "1.23"},
+		{"-123e-2", "-1.23"},
+		{"1E+3", "1000"},
+		{"1e20", "100000000000000000000"},
+		{"1e21", "1e21"},
+		{"1e22", "1e22"},
+		{"-1e22", "-1e22"},
+		{"0.000001", "0.000001"},
+		{"0.0000001", "1e-7"},
+		{"-0.0000001", "-1e-7"},
+		{"12345678901234567890123", "1.2345678901234567890123e22"},
+		{"0.1000000000000000000001", "0.1000000000000000000001"},
+		{"1e99999999999999999999", "1e99999999999999999999"},
+		{"-1e99999999999999999999", "-1e99999999999999999999"},
+	}
+	for _, tt := range tests {
+		if got := canonicalNumber(tt.in); got != tt.want {
+			t.Errorf("canonicalNumber(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCanonicalFields(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "sorted keys and quoted strings",
+			in:   `{"msg":"hi","b":"x","a":true}`,
+			want: `a=true b="x" msg="hi"`,
+		},
+		{
+			name: "null and numbers",
+			in:   `{"n":1.0,"m":-2.50,"z":null}`,
+			want: `m=-2.5 n=1 z=null`,
+		},
+		{
+			name: "nested values as sorted JSON",
+			in:   `{"ctx":{"b":10e-1,"a":[1.0,"x"]}}`,
+			want: `ctx="{\"a\":[1,\"x\"],\"b\":1}"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := joinFields(canonicalFields(decodeTestRecord(t, tt.in), convert.Options{})); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalHashEqualRecords(t *testing.T) {
+	a := decodeTestRecord(t, `{"a":1,"b":{"y":2.0,"x":"s"}}`)
+	b := decodeTestRecord(t, `{"b":{"x":"s","y":20e-1},"a":1.00}`)
+	if ha, hb := canonicalHash(a, convert.Options{}), canonicalHash(b, convert.Options{}); ha != hb {
+		t.Errorf("equal records hash differently: %s and %s", ha, hb)
+	}
+	c := map[string]interface{}{"a": json.Number("-1")}
+	if canonicalHash(c, convert.Options{}) == canonicalHash(map[string]interface{}{"a": json.Number("1")}, convert.Options{}) {
+		t.Error("-1 and 1 hash the same")
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"io"
+	"log"
+
+	"github.com/psanford/logfmt/convert"
+)
+
+// runCheck decodes the whole input without writing any records,
+// reporting decode errors with their offsets on stderr. Only the first
+// error is reported unless all is set, which decodes one record per
+// line so that it can continue past invalid lines. It returns the
+// number of errors found.
+func runCheck(in io.Reader, opts convert.RecordOptions, all bool) int {
+	opts.SkipErrors = all
+	opts.TextAs = ""
+	records := convert.NewDecoder(in, opts)
+	var count, errors int
+	for {
+		_, err := records.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			errors++
+			log.Print(err)
+			if _, ok := err.(*convert.LineError); ok && all {
+				continue
+			}
+			break
+		}
+		count++
+	}
+	infof("checked %d valid records, %d errors", count, errors)
+	return errors
+}
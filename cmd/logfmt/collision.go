@@ -0,0 +1,78 @@
+package main
+
+import "fmt"
+
+// collisionPolicy decides what happens when a transform writes a key
+// that is already present in the record.
+type collisionPolicy int
+
+const (
+	// collisionLast overwrites the existing value.
+	collisionLast collisionPolicy = iota
+	// collisionFirst keeps the existing value.
+	collisionFirst
+	// collisionError fails the record.
+	collisionError
+	// collisionMerge combines both values into an array.
+	collisionMerge
+)
+
+func parseCollisionPolicy(s string) (collisionPolicy, error) {
+	switch s {
+	case "last":
+		return collisionLast, nil
+	case "first":
+		return collisionFirst, nil
+	case "error":
+		return collisionError, nil
+	case "merge":
+		return collisionMerge, nil
+	}
+	return 0, fmt.Errorf("unknown -on-collision policy %q (expected last, first, error or merge)", s)
+}
+
+// collider applies a collisionPolicy to the keys written to one
+// record. It remembers the arrays a merge created, so that a third
+// value for a key is appended to them rather than nested as [[a,b],c],
+// while an array that came from the input is still merged as a single
+// value.
+type collider struct {
+	policy collisionPolicy
+	// merged holds the first element of each array made by a merge,
+	// which identifies the array as long as it isn't copied.
+	merged map[*interface{}]bool
+}
+
+// set stores v under key in rec according to the policy.
+func (c *collider) set(rec map[string]interface{}, key string, v interface{}) error {
+	old, exists := rec[key]
+	if !exists {
+		rec[key] = v
+		return nil
+	}
+
+	switch c.policy {
+	case collisionFirst:
+	case collisionError:
+		err := fmt.Errorf("key collision on %q", key)
+		if !*skipErrors {
+			return err
+		}
+		warnf("%s, keeping last value", err)
+		rec[key] = v
+	case collisionMerge:
+		merged := []interface{}{old, v}
+		if arr, ok := old.([]interface{}); ok && len(arr) > 0 && c.merged[&arr[0]] {
+			delete(c.merged, &arr[0])
+			merged = append(arr, v)
+		}
+		if c.merged == nil {
+			c.merged = make(map[*interface{}]bool)
+		}
+		c.merged[&merged[0]] = true
+		rec[key] = merged
+	default:
+		rec[key] = v
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCollider(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  collisionPolicy
+		rec     string
+		sets    []interface{} // values written to "a" in turn
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "new key",
+			policy: collisionError,
+			rec:    `{}`,
+			sets:   []interface{}{"x"},
+			want:   `{"a":"x"}`,
+		},
+		{
+			name:   "last",
+			policy: collisionLast,
+			rec:    `{"a":"old"}`,
+			sets:   []interface{}{"x", "y"},
+			want:   `{"a":"y"}`,
+		},
+		{
+			name:   "first",
+			policy: collisionFirst,
+			rec:    `{"a":"old"}`,
+			sets:   []interface{}{"x", "y"},
+			want:   `{"a":"old"}`,
+		},
+		{
+			name:    "error",
+			policy:  collisionError,
+			rec:     `{"a":"old"}`,
+			sets:    []interface{}{"x"},
+			wantErr: true,
+		},
+		{
+			name:   "merge",
+			policy: collisionMerge,
+			rec:    `{"a":"old"}`,
+			sets:   []interface{}{"x"},
+			want:   `{"a":["old","x"]}`,
+		},
+		{
+			name:   "merge three values stays flat",
+			policy: collisionMerge,
+			rec:    `{"a":"old"}`,
+			sets:   []interface{}{"x", "y"},
+			want:   `{"a":["old","x","y"]}`,
+		},
+		{
+			name:   "merge keeps an input array whole",
+			policy: collisionMerge,
+			rec:    `{"a":["p","q"]}`,
+			sets:   []interface{}{"x", "y"},
+			want:   `{"a":[["p","q"],"x","y"]}`,
+		},
+		{
+			name:   "merge an array value",
+			policy: collisionMerge,
+			rec:    `{"a":"old"}`,
+			sets:   []interface{}{[]interface{}{"x"}, "y"},
+			want:   `{"a":["old",["x"],"y"]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := decodeTestRecord(t, tt.rec)
+			c := &collider{policy: tt.policy}
+			var err error
+			for _, v := range tt.sets {
+				if err = c.set(rec, "a", v); err != nil {
+					break
+				}
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("no error, got %v", rec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := decodeTestRecord(t, tt.want); !reflect.DeepEqual(rec, want) {
+				t.Errorf("got %v, want %v", rec, want)
+			}
+		})
+	}
+}
+
+func TestColliderMergeAcrossTransforms(t *testing.T) {
+	c := &collider{policy: collisionMerge}
+	rec := decodeTestRecord(t, `{"user":"a","login":"b","uid":"c"}`)
+	for _, r := range []fieldRename{{from: "login", to: "user"}, {from: "uid", to: "user"}} {
+		if err := r.apply(rec, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := decodeTestRecord(t, `{"user":["a","b","c"]}`); !reflect.DeepEqual(rec, want) {
+		t.Errorf("got %v, want %v", rec, want)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// ANSI escape sequences used for colored output.
+const (
+	ansiReset   = "\x1b[0m"
+	ansiBold    = "\x1b[1m"
+	ansiDim     = "\x1b[2m"
+	ansiRed     = "\x1b[31m"
+	ansiGreen   = "\x1b[32m"
+	ansiYellow  = "\x1b[33m"
+	ansiBlue    = "\x1b[34m"
+	ansiMagenta = "\x1b[35m"
+	ansiCyan    = "\x1b[36m"
+	ansiGray    = "\x1b[90m"
+)
+
+// parseColorMode resolves -color: always, never, or auto, which
+// colors output written to a terminal unless NO_COLOR is set.
+func parseColorMode(mode string) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		return isTerminal(os.Stdout) && os.Getenv("NO_COLOR") == "", nil
+	}
+	return false, fmt.Errorf("unknown -color %q (expected auto, always or never)", mode)
+}
+
+// paint wraps s in the ANSI color, if there is one.
+func paint(color, s string) string {
+	if color == "" {
+		return s
+	}
+	return color + s + ansiReset
+}
+
+// severityColor is the color of a level value of each severity.
+func severityColor(sev severity) string {
+	switch {
+	case sev >= sevError:
+		return ansiRed
+	case sev == sevWarn:
+		return ansiYellow
+	case sev == sevInfo:
+		return ansiGreen
+	}
+	return ansiGray
+}
+
+// colorFields colors a logfmt record for a terminal: keys are dimmed
+// and values bright, except the value of the level field levelKey,
+// which is colored by its severity if it was recognized.
+func colorFields(fields []field, levelKey string, sev severity, sevKnown bool) {
+	for i := range fields {
+		f := &fields[i]
+		f.keyColor = ansiDim
+		if f.bare {
+			continue
+		}
+		f.valueColor = ansiBold
+		if f.key == levelKey && sevKnown {
+			f.valueColor = ansiBold + severityColor(sev)
+		}
+	}
+}
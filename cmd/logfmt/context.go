@@ -0,0 +1,66 @@
+package main
+
+// contextSeparator is written between groups of -A, -B and -C context
+// that aren't adjacent in the input, as grep does.
+const contextSeparator = "--"
+
+// contextFilter implements -A, -B and -C: besides each matching record
+// it writes up to after records following it and before records
+// preceding it, holding the latter back until a match shows whether
+// they are needed.
+type contextFilter struct {
+	before int
+	after  int
+
+	ring []item
+	// left counts the records still to be written after the last
+	// match.
+	left int
+	// wrote is set once any group has been written and gap once a
+	// record has been dropped since.
+	wrote bool
+	gap   bool
+	stats *runStats
+}
+
+// add returns the items to write for it: nothing, a context record
+// following a match, or a match preceded by a separator and its held
+// back context.
+func (c *contextFilter) add(it item) []item {
+	if it.synthetic {
+		return []item{it}
+	}
+	if it.context {
+		if c.left > 0 {
+			c.left--
+			return []item{it}
+		}
+		if c.before == 0 {
+			c.drop()
+			return nil
+		}
+		if len(c.ring) == c.before {
+			c.ring = c.ring[1:]
+			c.drop()
+		}
+		c.ring = append(c.ring, it)
+		return nil
+	}
+
+	var out []item
+	if c.wrote && c.gap {
+		out = append(out, item{seq: it.seq, line: contextSeparator, ok: true, synthetic: true, file: it.file})
+	}
+	out = append(out, c.ring...)
+	out = append(out, it)
+	c.ring = c.ring[:0]
+	c.left = c.after
+	c.wrote = true
+	c.gap = false
+	return out
+}
+
+func (c *contextFilter) drop() {
+	c.stats.filtered++
+	c.gap = true
+}
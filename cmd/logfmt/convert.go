@@ -0,0 +1,506 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/psanford/logfmt/convert"
+)
+
+// converter renders decoded records as output lines.
+type converter struct {
+	// opts is how keys and values are written, from -quote-char,
+	// -float-precision and -invalid-utf8.
+	opts convert.Options
+
+	// now is the clock used for anything relative to the current
+	// time. Tests can replace it for deterministic results.
+	now func() time.Time
+
+	exec       *execTransformer
+	jsonFields []string
+	// numericKeysAsArray turns nested objects keyed 0..n-1 into
+	// arrays.
+	numericKeysAsArray bool
+	flattener          *flattener
+	collide            collisionPolicy
+	renames            []fieldRename
+	levels             *levelDetector
+	minSeverity        severity
+	timeRange          *timeRange
+	// severities, if set, tags each item with its record's level for
+	// -syslog and -color.
+	severities *levelDetector
+	sets       []constField
+	folds      []*foldField
+	lookups    []*lookupTable
+	lookupDef  *string
+	arrayMode  string
+	collapseWS bool
+	replacers  []*valueReplacer
+	replaceIn  map[string]bool
+	requireAll []string
+	requireAny []string
+	filters    []filterExpr
+	selector   *fieldSelector
+	redact     *redactor
+	// keyPrefix is -key-prefix, and keyPrefixes the same with {file}
+	// replaced by each input's name, indexed by item.file.
+	keyPrefix   string
+	keyPrefixes []string
+	hashField   string
+	times       *timeFormatter
+	fieldOrder  *fieldOrder
+	keyLess     func(a, b string) bool
+	format      string
+	// prettyHeader lists, for -format=pretty, the candidate fields
+	// holding the time, level and message of a record.
+	prettyHeader [][]string
+	// template renders records for -template.
+	template         *recordTemplate
+	maxFields        int
+	delta            *deltaFilter
+	window           *windowAgg
+	dropEmptyRecords bool
+	maxKeyLen        int
+	// color adds ANSI colors to logfmt and pretty-json output.
+	color    bool
+	asString map[string]bool
+	asNumber map[string]bool
+	// numbersAsString quotes every JSON number exactly as written in
+	// the input.
+	numbersAsString bool
+	digitSep        string
+	humanize        *humanizer
+	jsonIndent      string
+	lineMatch       *regexp.Regexp
+	lineExclude     *regexp.Regexp
+	// greps are -grep and -grep-v, the positive one first.
+	greps []*recordGrep
+	// context keeps the records the selection filters reject,
+	// rendered and marked as context, for -A, -B and -C.
+	context bool
+
+	// uniq is only used to compute the dedup key; filtering happens
+	// in the recordWriter.
+	uniq *uniqFilter
+
+	// groupBy names the field whose value is passed to the
+	// recordWriter for -group-by headers.
+	groupBy string
+}
+
+// flushWindow returns the item for the last -window summary, if there
+// is one.
+func (c *converter) flushWindow(seq int) (item, bool) {
+	if c.window == nil {
+		return item{}, false
+	}
+	rec := c.window.flush()
+	if rec == nil {
+		return item{}, false
+	}
+	it := item{seq: seq}
+	c.renderRecord(&it, rec)
+	return it, true
+}
+
+// close releases any resources held by the converter.
+func (c *converter) close() {
+	if c.exec != nil {
+		c.exec.close()
+	}
+}
+
+// renderItem transforms, filters and formats the record held by it.
+func (c *converter) renderItem(it *item) {
+	if it.rec == nil {
+		return
+	}
+	rec, ok, matched, err := c.transformMatch(it.rec, it.file)
+	it.rec = nil
+	if err != nil || !ok {
+		it.err = err
+		return
+	}
+	it.context = !matched
+	if c.window != nil {
+		if rec = c.window.add(rec); rec == nil {
+			return
+		}
+		// the summary has its own keys
+		it.keys = nil
+	}
+	c.renderRecord(it, rec)
+	if c.times != nil && it.ok && !it.context {
+		c.times.commit()
+	}
+}
+
+// renderRecord formats a transformed record into it.
+func (c *converter) renderRecord(it *item, rec map[string]interface{}) {
+	if c.uniq != nil {
+		it.uniqKey = c.uniq.key(rec)
+	}
+	if v, ok := rec[c.groupBy]; ok && c.groupBy != "" {
+		it.group = c.opts.FormatValue(c.groupBy, v)
+	}
+	var levelKey string
+	if c.severities != nil {
+		levelKey, it.sev, it.sevKnown = c.severities.find(rec)
+	}
+	var matched bool
+	it.line, it.fields, it.ok, matched, it.err = c.formatRecord(rec, it.keys)
+	if it.ok && !matched {
+		it.context = true
+	}
+	if c.color && it.ok && c.format == "logfmt" {
+		colorFields(it.fields, shortenKey(c.opts.FormatKey(levelKey), c.maxKeyLen), it.sev, it.sevKnown)
+		if len(c.greps) > 0 && !c.greps[0].invert {
+			c.greps[0].highlight(it.fields, c.opts, c.maxKeyLen)
+		}
+		it.line = joinFields(it.fields)
+	}
+}
+
+// transform applies the record level transforms and filters to a
+// record read from input file. ok is false if the record was filtered
+// out.
+func (c *converter) transform(rec map[string]interface{}, file int) (out map[string]interface{}, ok bool, err error) {
+	out, ok, matched, err := c.transformMatch(rec, file)
+	if c.times != nil && ok && matched {
+		c.times.commit()
+	}
+	return out, ok && matched, err
+}
+
+// transformMatch is transform reporting the record level selection
+// (-min-level, -require, -require-any and -filter) separately from
+// ok: with -A, -B or -C a record they reject is still transformed,
+// with matched false, since it may be written as context.
+//
+// Records are processed in this order: -exec, -parse-json-field,
+// -numeric-keys, -flatten, -rename/-normalize, level filtering, -set,
+// -fold, -lookup, -array-mode, -collapse-ws, -replace, time handling,
+// -require and -filter filtering, -only/-exclude, -redact, -key-prefix
+// and -hash-field; formatRecord then orders and formats the fields.
+// Time handling runs after flattening so that -time-field may name a
+// flattened key such as meta.ts. Without -flatten a dotted -time-field
+// is looked up through nested objects.
+func (c *converter) transformMatch(rec map[string]interface{}, file int) (out map[string]interface{}, ok, matched bool, err error) {
+	matched = true
+	// reject records a selection miss, returning true if the record
+	// should be dropped rather than kept for context.
+	reject := func() bool {
+		matched = false
+		return !c.context
+	}
+	collide := &collider{policy: c.collide}
+
+	if c.exec != nil {
+		rec, err = c.exec.apply(rec)
+		if err != nil {
+			if *skipErrors {
+				warnf("skipping record: %s", err)
+				return nil, false, false, nil
+			}
+			return nil, false, false, err
+		}
+		if rec == nil {
+			return nil, false, false, nil
+		}
+	}
+
+	for _, f := range c.jsonFields {
+		if err := parseJSONField(rec, f, *parseJSONNest, collide); err != nil {
+			return nil, false, false, err
+		}
+	}
+
+	if c.numericKeysAsArray {
+		for k, v := range rec {
+			rec[k] = numericKeysToArrays(v)
+		}
+	}
+
+	if c.flattener != nil {
+		rec, err = c.flattener.apply(rec, collide)
+		if err != nil {
+			return nil, false, false, err
+		}
+	}
+
+	for _, r := range c.renames {
+		if err := r.apply(rec, collide); err != nil {
+			return nil, false, false, err
+		}
+	}
+
+	if c.levels != nil {
+		sev, found := c.levels.severity(rec)
+		if (!found && !*keepUnknownLevel) || (found && sev < c.minSeverity) {
+			if reject() {
+				return nil, false, false, nil
+			}
+		}
+	}
+
+	if c.timeRange != nil && !c.timeRange.match(rec) && reject() {
+		return nil, false, false, nil
+	}
+
+	for _, f := range c.sets {
+		if _, exists := rec[f.key]; !exists || *setForce {
+			rec[f.key] = f.value
+		}
+	}
+
+	for _, f := range c.folds {
+		if err := f.apply(rec, collide); err != nil {
+			return nil, false, false, err
+		}
+	}
+
+	for _, l := range c.lookups {
+		if err := l.apply(rec, c.lookupDef, collide); err != nil {
+			return nil, false, false, err
+		}
+	}
+
+	if c.arrayMode == "count" || c.arrayMode == "counts" {
+		summarizeArrays(rec, c.arrayMode)
+	}
+
+	if c.collapseWS {
+		for k, v := range rec {
+			if s, ok := v.(string); ok {
+				rec[k] = collapseWhitespace(s, *collapseNewlines)
+			}
+		}
+	}
+
+	if len(c.replacers) > 0 {
+		applyReplacers(rec, c.replacers, c.replaceIn)
+	}
+
+	// -window reads the original times and renders its own
+	if c.times != nil && c.window == nil {
+		c.times.apply(rec)
+	}
+
+	for _, k := range c.requireAll {
+		if _, ok := rec[k]; !ok && reject() {
+			return nil, false, false, nil
+		}
+	}
+	if len(c.requireAny) > 0 {
+		found := false
+		for _, k := range c.requireAny {
+			if _, ok := rec[k]; ok {
+				found = true
+				break
+			}
+		}
+		if !found && reject() {
+			return nil, false, false, nil
+		}
+	}
+
+	for _, f := range c.filters {
+		if !f.match(rec) && reject() {
+			return nil, false, false, nil
+		}
+	}
+
+	if c.selector != nil {
+		c.selector.apply(rec)
+	}
+
+	if c.redact != nil {
+		c.redact.apply(rec)
+	}
+
+	prefix := c.keyPrefix
+	if file < len(c.keyPrefixes) {
+		prefix = c.keyPrefixes[file]
+	}
+	if prefix != "" {
+		prefixed := make(map[string]interface{}, len(rec))
+		for k, v := range rec {
+			prefixed[prefix+k] = v
+		}
+		rec = prefixed
+	}
+
+	if c.hashField != "" {
+		hash := canonicalHash(rec, c.opts)
+		if err := collide.set(rec, prefix+c.hashField, hash); err != nil {
+			return nil, false, false, err
+		}
+	}
+
+	return rec, true, matched, nil
+}
+
+// formatRecord renders rec as an output line, keeping only the fields
+// -delta selects and then only the first -max-fields fields after
+// ordering. With -drop-empty-records a record left with no fields is
+// filtered out rather than written as an empty line. fields holds the
+// individual logfmt key/value pairs making up line, and is nil for
+// other output formats. ok is false if the line was filtered out, and
+// matched is false if -line-grep, -line-grep-v, -grep or -grep-v
+// rejects it, in which case with -A, -B or -C the line is still
+// returned for context. keys, if set, is the input order of the
+// record's keys for -preserve-order.
+func (c *converter) formatRecord(rec map[string]interface{}, keys []string) (line string, fields []field, ok, matched bool, err error) {
+	var deltaState map[string]string
+	if c.delta != nil {
+		rec, deltaState = c.delta.diff(rec)
+	}
+	if c.dropEmptyRecords && len(rec) == 0 {
+		return "", nil, false, false, nil
+	}
+
+	less := c.keyLess
+	if keys != nil {
+		less = c.fieldOrder.inputLess(keys)
+	}
+	sortedFields := sortKeys(rec, less)
+	dropped := 0
+	if c.maxFields > 0 && len(sortedFields) > c.maxFields {
+		dropped = len(sortedFields) - c.maxFields
+		sortedFields = sortedFields[:c.maxFields]
+	}
+
+	switch c.format {
+	case "json":
+		line, err = formatJSONRecord(rec, sortedFields, *jsonPretty, c.jsonIndent)
+		if err != nil {
+			return "", nil, false, false, err
+		}
+	case "pretty":
+		line = c.formatPretty(rec, sortedFields, dropped)
+	case "template":
+		line, err = c.formatTemplate(rec, sortedFields, dropped)
+		if err != nil {
+			return "", nil, false, false, err
+		}
+	case "pretty-json":
+		line, err = formatPrettyJSON(rec, sortedFields, c.color)
+		if err != nil {
+			return "", nil, false, false, err
+		}
+	case "canonical":
+		fields = canonicalFields(rec, c.opts)
+		line = joinFields(fields)
+	default:
+		fields = c.logfmtFields(rec, sortedFields)
+		if dropped > 0 {
+			fields = append(fields, field{key: fmt.Sprintf("…+%d", dropped), bare: true})
+		}
+		line = joinFields(fields)
+	}
+
+	matched = (c.lineMatch == nil || c.lineMatch.MatchString(line)) &&
+		(c.lineExclude == nil || !c.lineExclude.MatchString(line))
+	for _, g := range c.greps {
+		matched = matched && g.match(rec, line)
+	}
+	if !matched && !c.context {
+		return "", nil, false, false, nil
+	}
+	if c.delta != nil {
+		c.delta.commit(deltaState)
+	}
+
+	return line, fields, true, matched, nil
+}
+
+func (c *converter) logfmtFields(rec map[string]interface{}, sortedFields []string) []field {
+	fields := make([]field, len(sortedFields))
+	for i, key := range sortedFields {
+		fields[i] = field{key: shortenKey(c.opts.FormatKey(key), c.maxKeyLen), value: c.formatValue(key, rec[key])}
+	}
+	return fields
+}
+
+// formatValue renders the value of key, applying any -as-string or
+// -as-number coercion before the normal value formatting.
+func (c *converter) formatValue(key string, v interface{}) string {
+	if c.asString[key] {
+		if v == nil {
+			return c.opts.QuoteString("")
+		}
+		return c.opts.QuoteString(convert.PlainValue(v))
+	}
+	if c.asNumber[key] {
+		if n, ok := numericText(key, v, c.opts); ok {
+			return n
+		}
+	}
+	if c.humanize != nil {
+		if s, ok := c.humanize.format(key, v); ok {
+			return s
+		}
+	}
+	if n, ok := v.(json.Number); ok && c.numbersAsString {
+		return c.opts.QuoteString(string(n))
+	}
+	if c.digitSep != "" {
+		if n, ok := v.(json.Number); ok {
+			if _, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+				return c.opts.EscapeString(groupDigits(string(n), c.digitSep))
+			}
+		}
+	}
+	return c.opts.FormatValue(key, v)
+}
+
+// groupDigits inserts sep between each group of three digits of the
+// integer n, e.g. 1234567 becomes 1,234,567.
+func groupDigits(n, sep string) string {
+	sign := ""
+	if strings.HasPrefix(n, "-") || strings.HasPrefix(n, "+") {
+		sign, n = n[:1], n[1:]
+	}
+	if len(n) <= 3 {
+		return sign + n
+	}
+
+	var b strings.Builder
+	b.WriteString(sign)
+	first := len(n) % 3
+	if first == 0 {
+		first = 3
+	}
+	b.WriteString(n[:first])
+	for i := first; i < len(n); i += 3 {
+		b.WriteString(sep)
+		b.WriteString(n[i : i+3])
+	}
+	return b.String()
+}
+
+// numericText returns the text of v if it is, or is a string holding,
+// a finite number.
+func numericText(key string, v interface{}, opts convert.Options) (string, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		return n.String(), true
+	case float64, float32, int, int64:
+		return opts.FormatValue(key, n), true
+	case string:
+		s := strings.TrimSpace(n)
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return "", false
+		}
+		return s, true
+	}
+	return "", false
+}
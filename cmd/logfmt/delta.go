@@ -0,0 +1,56 @@
+package main
+
+import "github.com/psanford/logfmt/convert"
+
+// deltaRemoved is the value -delta-removed shows for a field the
+// previous record had but the current one lacks.
+const deltaRemoved = "∅"
+
+// deltaFilter implements -delta: each record is reduced to the fields
+// whose rendered value differs from the previous record's, plus the
+// keep fields, which are always written. The first record is written
+// whole.
+//
+// It is stateful and streaming: only the previous record is held, and
+// records must be seen in input order, so -delta is only used with
+// -concurrency 1. The previous record is the last one written, not
+// one dropped by a later filter such as -line-grep.
+type deltaFilter struct {
+	keep        map[string]bool
+	showRemoved bool
+	// opts renders values to compare them.
+	opts convert.Options
+
+	prev map[string]string
+}
+
+// diff returns the fields of rec to write, and the rendered values to
+// pass to commit if the record is written.
+func (d *deltaFilter) diff(rec map[string]interface{}) (out map[string]interface{}, cur map[string]string) {
+	cur = make(map[string]string, len(rec))
+	for k, v := range rec {
+		cur[k] = d.opts.FormatValue(k, v)
+	}
+	if d.prev == nil {
+		return rec, cur
+	}
+
+	out = make(map[string]interface{}, len(rec))
+	for k, v := range rec {
+		if prev, ok := d.prev[k]; !ok || prev != cur[k] || d.keep[k] {
+			out[k] = v
+		}
+	}
+	if d.showRemoved {
+		for k := range d.prev {
+			if _, ok := rec[k]; !ok {
+				out[k] = deltaRemoved
+			}
+		}
+	}
+	return out, cur
+}
+
+func (d *deltaFilter) commit(cur map[string]string) {
+	d.prev = cur
+}
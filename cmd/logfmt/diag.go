@@ -0,0 +1,43 @@
+package main
+
+import "log"
+
+// Exit codes other than 0 (success) and 1 (fatal error, via log.Fatal).
+const (
+	// exitEmpty means -warn-empty found no input records.
+	exitEmpty = 3
+	// exitLimit means output stopped at the -limit-bytes cap.
+	exitLimit = 4
+	// exitAssert means a -fail-on-empty or -fail-on-nonempty check
+	// failed.
+	exitAssert = 5
+)
+
+// Diagnostics are always written to stderr (via the log package) so
+// that stdout only carries formatted records. Fatal errors are always
+// reported; warnings are silenced by -quiet and informational messages
+// require -verbose.
+
+func warnf(format string, args ...interface{}) {
+	if !*quiet {
+		log.Printf(format, args...)
+	}
+}
+
+func infof(format string, args ...interface{}) {
+	if *verbose && !*quiet {
+		log.Printf(format, args...)
+	}
+}
+
+// runStats counts what happened to each input record.
+type runStats struct {
+	records  int
+	invalid  int
+	written  int
+	filtered int
+}
+
+func (s *runStats) report() {
+	infof("processed %d records: %d written, %d filtered, %d invalid", s.records, s.written, s.filtered, s.invalid)
+}
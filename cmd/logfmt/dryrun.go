@@ -0,0 +1,188 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// describeConfig writes a human readable summary of the resolved
+// pipeline for -dry-run.
+func describeConfig(w io.Writer, c *converter, rw *recordWriter) {
+	p := func(format string, args ...interface{}) {
+		fmt.Fprintf(w, format+"\n", args...)
+	}
+
+	if *reverse {
+		p("input: one logfmt record per line (skip-errors=%t)", *skipErrors)
+	} else if *textAs != "" {
+		p("input: one JSON record per line, wrapping other lines as %s=<line>", *textAs)
+	} else if *passthroughStderr {
+		p("input: one JSON record per line, writing invalid lines to stderr")
+	} else if *passthrough {
+		p("input: one JSON record per line, writing invalid lines as is")
+	} else if *skipErrors {
+		p("input: one JSON record per line, skipping invalid lines (error-field=%t)", *errorField)
+	} else if *inputFraming == "newline" {
+		p("input: one JSON record per line")
+	} else {
+		p("input: JSON stream")
+	}
+
+	p("transforms (in order):")
+	if c.exec != nil {
+		p("  exec: %s", c.exec.command)
+	}
+	if len(c.jsonFields) > 0 {
+		p("  parse-json-field: %s (nest=%t)", strings.Join(c.jsonFields, ","), *parseJSONNest)
+	}
+	if c.numericKeysAsArray {
+		p("  numeric-keys: array")
+	}
+	if c.flattener != nil {
+		p("  flatten: %t arrays: %t max-depth: %d prefix: %q raw-json: %s", c.flattener.enabled, c.flattener.arrays, c.flattener.maxDepth, c.flattener.prefix, strings.Join(sortedSet(c.flattener.rawJSON), ","))
+	}
+	for _, r := range c.renames {
+		if !r.ifAbsent {
+			p("  rename: %s -> %s", r.from, r.to)
+		}
+	}
+	if *normalize {
+		p("  normalize: time, level and msg keys")
+	}
+	if c.levels != nil {
+		p("  min-level: %s (fields=%s, level-numbers=%s, keep-unknown=%t)", *minLevel, strings.Join(c.levels.fields, ","), *levelNumbers, *keepUnknownLevel)
+	}
+	if c.timeRange != nil {
+		p("  time-range: %s", c.timeRange)
+	}
+	for _, f := range c.sets {
+		p("  set: %s=%s (force=%t)", f.key, f.value, *setForce)
+	}
+	for _, f := range c.folds {
+		p("  fold: %s from %s", f.key, strings.Join(f.refs, ","))
+	}
+	for _, l := range c.lookups {
+		p("  lookup: %s -> %s (%d entries)", l.field, l.outKey, len(l.table))
+	}
+	if c.arrayMode != "value" {
+		p("  array-mode: %s", c.arrayMode)
+	}
+	if c.collapseWS {
+		p("  collapse-ws (newlines=%t)", *collapseNewlines)
+	}
+	for _, r := range c.replacers {
+		p("  replace: %s -> %q", r.re, r.repl)
+	}
+	if c.times != nil {
+		if c.times.relative {
+			base := "first record"
+			if *timeSince == "prev" {
+				base = "previous record"
+			} else if *timeSince != "" && *timeSince != "first" {
+				base = *timeSince
+			}
+			p("  time: %s -> relative to %s", strings.Join(c.times.fields, ","), base)
+		} else {
+			zone := "as given"
+			if c.times.loc != nil {
+				zone = c.times.loc.String()
+			}
+			p("  time: %s -> %q (zone %s)", strings.Join(c.times.fields, ","), c.times.layout, zone)
+		}
+	}
+	if len(c.requireAll) > 0 {
+		p("  require: %s", strings.Join(c.requireAll, ","))
+	}
+	if len(c.requireAny) > 0 {
+		p("  require-any: %s", strings.Join(c.requireAny, ","))
+	}
+	for _, f := range filters {
+		p("  filter: %s", f)
+	}
+	if c.selector != nil {
+		p("  select: %s", c.selector)
+	}
+	if c.redact != nil {
+		p("  redact: %s", c.redact)
+	}
+	if c.keyPrefix != "" {
+		p("  key-prefix: %s", c.keyPrefix)
+	}
+	if c.hashField != "" {
+		p("  hash-field: %s (sha256)", c.keyPrefix+c.hashField)
+	}
+	p("  on-collision: %s", *onCollision)
+
+	head := sortedByIndex(c.fieldOrder.Head)
+	tail := sortedByIndex(c.fieldOrder.Tail)
+	p("order: %s ... %s", strings.Join(head, ","), strings.Join(tail, ","))
+	if *preserveOrder {
+		p("  preserve-order: unlisted fields in input order")
+	}
+
+	if statsBy != nil {
+		p("stats: by=%s top=%d", *statsBy, *statsTop)
+	}
+	p("output: format=%s buffer=%d concurrency=%d align=%t", c.format, *outputBufferSize, *concurrency, rw.out.align != nil)
+	if c.format == "pretty" {
+		var header []string
+		for _, candidates := range c.prettyHeader {
+			header = append(header, strings.Join(candidates, "|"))
+		}
+		p("  pretty: header %s", strings.Join(header, " "))
+	}
+	if c.color && c.format == "logfmt" {
+		p("  color: by level of %s", strings.Join(c.severities.fields, ","))
+	}
+
+	// every flag not at its default, so that nothing set on the command
+	// line or by -preset goes unreported
+	p("flags:")
+	flag.VisitAll(func(f *flag.Flag) {
+		if strings.HasPrefix(f.Usage, "Alias for -") || f.Name == "dry-run" {
+			return
+		}
+		if list, ok := f.Value.(*stringsFlag); ok {
+			for _, v := range *list {
+				p("  -%s=%s", f.Name, quoteFlagValue(v))
+			}
+			return
+		}
+		if v := f.Value.String(); v != f.DefValue {
+			p("  -%s=%s", f.Name, quoteFlagValue(v))
+		}
+	})
+}
+
+// quoteFlagValue quotes a -dry-run flag value if it wouldn't otherwise
+// read back as a single shell word.
+func quoteFlagValue(v string) string {
+	if v == "" || strings.ContainsAny(v, " \t\n'\"\\$`*?[]|&;<>()") {
+		return strconv.Quote(v)
+	}
+	return v
+}
+
+func sortedSet(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedByIndex(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return m[keys[i]] < m[keys[j]]
+	})
+	return keys
+}
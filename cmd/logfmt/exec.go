@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+
+	"github.com/psanford/logfmt/convert"
+)
+
+// execTransformer pipes each record through a long lived subprocess.
+// The command reads one JSON object per line on stdin and must write
+// exactly one line per input (flushing after each, e.g. jq --unbuffered)
+// holding the transformed object, or null to drop the record.
+type execTransformer struct {
+	command string
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+func (e *execTransformer) start() error {
+	cmd := exec.Command("sh", "-c", e.command)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("-exec %q: %w", e.command, err)
+	}
+	e.cmd = cmd
+	e.stdin = stdin
+	e.stdout = bufio.NewReader(stdout)
+	return nil
+}
+
+// apply sends rec to the subprocess and returns its reply. A nil
+// record means the subprocess dropped it. If the subprocess fails it
+// is killed and restarted for the next record.
+func (e *execTransformer) apply(rec map[string]interface{}) (map[string]interface{}, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.cmd == nil {
+		if err := e.start(); err != nil {
+			return nil, err
+		}
+	}
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	b = append(b, '\n')
+
+	if _, err := e.stdin.Write(b); err != nil {
+		e.kill()
+		return nil, fmt.Errorf("-exec write: %w", err)
+	}
+	reply, err := e.stdout.ReadBytes('\n')
+	if err != nil {
+		e.kill()
+		return nil, fmt.Errorf("-exec read: %w", err)
+	}
+
+	out, err := convert.DecodeRecord(reply)
+	if err != nil {
+		return nil, fmt.Errorf("-exec returned invalid JSON: %w", err)
+	}
+	return out, nil
+}
+
+func (e *execTransformer) kill() {
+	e.cmd.Process.Kill()
+	e.cmd.Wait()
+	e.cmd = nil
+}
+
+// close shuts down the subprocess, waiting for it to exit.
+func (e *execTransformer) close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.cmd == nil {
+		return
+	}
+	e.stdin.Close()
+	if err := e.cmd.Wait(); err != nil {
+		warnf("-exec %q: %s", e.command, err)
+	}
+	e.cmd = nil
+}
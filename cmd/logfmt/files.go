@@ -0,0 +1,282 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/psanford/logfmt/convert"
+)
+
+// openInput opens the input named on the command line: - for stdin,
+// otherwise a file. gzip and zstd compressed input is recognized by its
+// magic bytes and transparently decompressed.
+func openInput(path string) (io.ReadCloser, error) {
+	var f io.ReadCloser = io.NopCloser(os.Stdin)
+	if path != "-" {
+		var err error
+		if f, err = os.Open(path); err != nil {
+			return nil, err
+		}
+	}
+
+	r, err := convert.Decompress(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %s", inputDisplayName(path), err)
+	}
+	return &decompressedFile{Reader: r, closeFn: r.Close, f: f}, nil
+}
+
+// decompressedFile closes both the decompressor and the underlying
+// file.
+type decompressedFile struct {
+	io.Reader
+	closeFn func() error
+	f       io.Closer
+}
+
+func (d *decompressedFile) Close() error {
+	if d.closeFn != nil {
+		d.closeFn()
+	}
+	return d.f.Close()
+}
+
+// inputDisplayName is how an input path is shown by -emit-meta and
+// -tag-source.
+func inputDisplayName(path string) string {
+	if path == "-" {
+		return "stdin"
+	}
+	return path
+}
+
+// multiReader reads the records of several inputs one after another,
+// opening each only once the previous one is exhausted.
+type multiReader struct {
+	paths []string
+	opts  convert.RecordOptions
+
+	// keepGoing skips inputs that can't be opened, and the rest of an
+	// input after a fatal decode error, with a warning instead of
+	// stopping.
+	keepGoing bool
+
+	// follow keeps reading the (single) input as it grows, see
+	// followReader.
+	follow bool
+
+	// wrap, if set, is applied to each opened input, e.g. to count
+	// bytes for -bench.
+	wrap func(io.Reader) io.Reader
+
+	cur    int
+	r      *convert.Decoder
+	closer io.Closer
+}
+
+func (m *multiReader) Next() (map[string]interface{}, error) {
+	for {
+		if m.r == nil {
+			if m.cur >= len(m.paths) {
+				return nil, io.EOF
+			}
+			if err := m.open(); err != nil {
+				if m.keepGoing {
+					warnf("skipping %s", err)
+					m.cur++
+					continue
+				}
+				return nil, err
+			}
+		}
+
+		rec, err := m.r.Decode()
+		if err == io.EOF {
+			m.next()
+			continue
+		}
+		if _, ok := err.(*convert.LineError); err != nil && !ok && m.keepGoing {
+			warnf("skipping the rest of %s: %s", m.paths[m.cur], err)
+			m.next()
+			continue
+		}
+		return rec, err
+	}
+}
+
+func (m *multiReader) open() error {
+	path := m.paths[m.cur]
+	var in io.ReadCloser
+	var err error
+	if m.follow {
+		in, err = openFollow(path)
+	} else {
+		in, err = openInput(path)
+	}
+	if err != nil {
+		return err
+	}
+	infof("reading %s", inputDisplayName(path))
+	var r io.Reader = in
+	if m.wrap != nil {
+		r = m.wrap(r)
+	}
+	m.r = convert.NewDecoder(r, m.opts)
+	m.closer = in
+	return nil
+}
+
+func (m *multiReader) next() {
+	m.closer.Close()
+	m.r = nil
+	m.closer = nil
+	m.cur++
+}
+
+func (m *multiReader) Line() int {
+	if m.r == nil {
+		return 0
+	}
+	return m.r.Line()
+}
+
+func (m *multiReader) Keys() []string {
+	if m.r == nil {
+		return nil
+	}
+	return m.r.Keys()
+}
+
+func (m *multiReader) File() int {
+	return m.cur
+}
+
+func (m *multiReader) Name() string {
+	if m.cur >= len(m.paths) {
+		return ""
+	}
+	return inputDisplayName(m.paths[m.cur])
+}
+
+// close closes the current input, if one is open.
+func (m *multiReader) close() {
+	if m.closer != nil {
+		m.closer.Close()
+	}
+}
+
+// inputSource is implemented by the readers that know which input each
+// record came from.
+type inputSource interface {
+	// File returns the index of the input holding the last record.
+	File() int
+	// Name returns the display name of the input holding the last
+	// record.
+	Name() string
+}
+
+// mergeReader implements -merge-by-time: it reads all inputs at once
+// and returns their records interleaved in time order. Each input is
+// assumed to be in time order already, so only its next record is
+// held. A record without a parseable time gets the time of the record
+// before it in the same input, keeping e.g. -text-as lines next to the
+// record they follow.
+type mergeReader struct {
+	inputs     []*multiReader
+	timeFields []string
+
+	// per input: the next record, if read, the line it started on and
+	// its time
+	pending []map[string]interface{}
+	keys    [][]string
+	lines   []int
+	times   []time.Time
+	done    []bool
+
+	cur int
+}
+
+func newMergeReader(paths []string, opts convert.RecordOptions, keepGoing bool, timeFields []string) *mergeReader {
+	m := &mergeReader{
+		inputs:     make([]*multiReader, len(paths)),
+		timeFields: timeFields,
+		pending:    make([]map[string]interface{}, len(paths)),
+		keys:       make([][]string, len(paths)),
+		lines:      make([]int, len(paths)),
+		times:      make([]time.Time, len(paths)),
+		done:       make([]bool, len(paths)),
+	}
+	for i, p := range paths {
+		m.inputs[i] = &multiReader{paths: []string{p}, opts: opts, keepGoing: keepGoing}
+	}
+	return m
+}
+
+func (m *mergeReader) Next() (map[string]interface{}, error) {
+	for i, in := range m.inputs {
+		if m.done[i] || m.pending[i] != nil {
+			continue
+		}
+		rec, err := in.Next()
+		// a JSON null decodes as no record at all, so read past it
+		// rather than taking the input as exhausted
+		for rec == nil && err == nil {
+			rec, err = in.Next()
+		}
+		if err == io.EOF {
+			m.done[i] = true
+			continue
+		}
+		if err != nil {
+			// the input is read again on the next call, which
+			// continues past a *convert.LineError
+			m.cur = i
+			return nil, err
+		}
+		m.pending[i] = rec
+		m.keys[i] = in.Keys()
+		m.lines[i] = in.Line()
+		if ts, _, _, ok := findTime(rec, m.timeFields); ok {
+			m.times[i] = ts
+		}
+	}
+
+	next := -1
+	for i, rec := range m.pending {
+		if rec != nil && (next < 0 || m.times[i].Before(m.times[next])) {
+			next = i
+		}
+	}
+	if next < 0 {
+		return nil, io.EOF
+	}
+	rec := m.pending[next]
+	m.pending[next] = nil
+	m.cur = next
+	return rec, nil
+}
+
+func (m *mergeReader) Line() int {
+	return m.lines[m.cur]
+}
+
+func (m *mergeReader) Keys() []string {
+	return m.keys[m.cur]
+}
+
+func (m *mergeReader) File() int {
+	return m.cur
+}
+
+func (m *mergeReader) Name() string {
+	return m.inputs[m.cur].Name()
+}
+
+func (m *mergeReader) close() {
+	for _, in := range m.inputs {
+		in.close()
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/psanford/logfmt/convert"
+)
+
+func TestMergeReader(t *testing.T) {
+	tests := []struct {
+		name   string
+		inputs []string
+		want   []string
+	}{
+		{
+			name: "interleaved",
+			inputs: []string{
+				`{"time":"2024-01-01T00:00:01Z","id":"a1"}` + "\n" + `{"time":"2024-01-01T00:00:03Z","id":"a3"}` + "\n",
+				`{"time":"2024-01-01T00:00:02Z","id":"b2"}` + "\n",
+			},
+			want: []string{"a1", "b2", "a3"},
+		},
+		{
+			name: "null records",
+			inputs: []string{
+				`{"time":"2024-01-01T00:00:01Z","id":"a1"}` + "\nnull\nnull\n" + `{"time":"2024-01-01T00:00:03Z","id":"a3"}` + "\n",
+				"null\n" + `{"time":"2024-01-01T00:00:02Z","id":"b2"}` + "\n",
+			},
+			want: []string{"a1", "b2", "a3"},
+		},
+		{
+			name: "only null",
+			inputs: []string{
+				"null\n",
+				`{"time":"2024-01-01T00:00:02Z","id":"b2"}` + "\n",
+			},
+			want: []string{"b2"},
+		},
+		{
+			name: "untimed record keeps its place",
+			inputs: []string{
+				`{"time":"2024-01-01T00:00:01Z","id":"a1"}` + "\n" + `{"id":"a-"}` + "\n" + `{"time":"2024-01-01T00:00:03Z","id":"a3"}` + "\n",
+				`{"time":"2024-01-01T00:00:02Z","id":"b2"}` + "\n",
+			},
+			want: []string{"a1", "a-", "b2", "a3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			var paths []string
+			for i, in := range tt.inputs {
+				path := filepath.Join(dir, string(rune('a'+i))+".json")
+				if err := os.WriteFile(path, []byte(in), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				paths = append(paths, path)
+			}
+
+			m := newMergeReader(paths, convert.RecordOptions{}, false, []string{"time"})
+			defer m.close()
+			var got []string
+			for {
+				rec, err := m.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, rec["id"].(string))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
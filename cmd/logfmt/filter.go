@@ -0,0 +1,273 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/psanford/logfmt/convert"
+)
+
+// A filterExpr is a parsed -filter expression. Expressions are
+// comparisons such as level=error, status>=500 or msg~timeout,
+// combined with AND and OR (or && and ||) and grouped with
+// parentheses. AND binds tighter than OR.
+type filterExpr interface {
+	match(rec map[string]interface{}) bool
+}
+
+type filterAnd []filterExpr
+
+func (e filterAnd) match(rec map[string]interface{}) bool {
+	for _, sub := range e {
+		if !sub.match(rec) {
+			return false
+		}
+	}
+	return true
+}
+
+type filterOr []filterExpr
+
+func (e filterOr) match(rec map[string]interface{}) bool {
+	for _, sub := range e {
+		if sub.match(rec) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterOps are the comparison operators, longest first so that >=
+// isn't read as >.
+var filterOps = []string{"!=", ">=", "<=", "!~", "=", ">", "<", "~"}
+
+// filterCond compares one field against a value. Ordering comparisons
+// are numeric when the value is a number, and otherwise compare the
+// field's text bytewise, which suits RFC 3339 times. A missing field
+// only matches != and !~.
+type filterCond struct {
+	key   string
+	op    string
+	value string
+	num   float64
+	isNum bool
+	re    *regexp.Regexp
+}
+
+func (c *filterCond) match(rec map[string]interface{}) bool {
+	parent, leaf, ok := lookupPath(rec, c.key)
+	if !ok {
+		return c.op == "!=" || c.op == "!~"
+	}
+	v := parent[leaf]
+	text := ""
+	if v != nil {
+		text = convert.PlainValue(v)
+	}
+
+	switch c.op {
+	case "~":
+		return c.re.MatchString(text)
+	case "!~":
+		return !c.re.MatchString(text)
+	}
+
+	cmp := strings.Compare(text, c.value)
+	if c.isNum {
+		n, ok := filterNumber(v)
+		if !ok {
+			return c.op == "!="
+		}
+		switch {
+		case n < c.num:
+			cmp = -1
+		case n > c.num:
+			cmp = 1
+		default:
+			cmp = 0
+		}
+	}
+	switch c.op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	}
+	return cmp <= 0
+}
+
+// filterNumber returns the numeric value of v, which may be a number
+// of any kind, including those the transforms produce such as the
+// counts of -array-mode, or a string holding one.
+func filterNumber(v interface{}) (float64, bool) {
+	if s, ok := v.(string); ok {
+		v = strings.TrimSpace(s)
+	}
+	return numericValue(v)
+}
+
+// parseFilter parses a -filter expression.
+func parseFilter(expr string) (filterExpr, error) {
+	p := &filterParser{s: expr}
+	e, err := p.or()
+	if err != nil {
+		return nil, fmt.Errorf("invalid -filter %q: %s", expr, err)
+	}
+	if p.skipSpace(); p.pos < len(p.s) {
+		return nil, fmt.Errorf("invalid -filter %q: unexpected %q", expr, p.s[p.pos:])
+	}
+	return e, nil
+}
+
+type filterParser struct {
+	s   string
+	pos int
+}
+
+func (p *filterParser) skipSpace() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// keyword consumes one of words if it comes next, as a whole word for
+// the alphabetic ones.
+func (p *filterParser) keyword(words ...string) bool {
+	p.skipSpace()
+	rest := p.s[p.pos:]
+	for _, w := range words {
+		if !strings.HasPrefix(rest, w) {
+			continue
+		}
+		if w[0] >= 'A' && w[0] <= 'Z' && len(rest) > len(w) && rest[len(w)] != ' ' && rest[len(w)] != '(' {
+			continue
+		}
+		p.pos += len(w)
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) or() (filterExpr, error) {
+	var terms filterOr
+	for {
+		e, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, e)
+		if !p.keyword("OR", "||") {
+			break
+		}
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+func (p *filterParser) and() (filterExpr, error) {
+	var terms filterAnd
+	for {
+		e, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, e)
+		if !p.keyword("AND", "&&") {
+			break
+		}
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+func (p *filterParser) operand() (filterExpr, error) {
+	if p.keyword("(") {
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.keyword(")") {
+			return nil, fmt.Errorf("missing )")
+		}
+		return e, nil
+	}
+	return p.cond()
+}
+
+func (p *filterParser) cond() (filterExpr, error) {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.s) && !strings.ContainsRune("=!<>~ ()", rune(p.s[p.pos])) {
+		p.pos++
+	}
+	c := &filterCond{key: p.s[start:p.pos]}
+	if c.key == "" {
+		return nil, fmt.Errorf("expected a field name at %q", p.s[start:])
+	}
+	for _, op := range filterOps {
+		if strings.HasPrefix(p.s[p.pos:], op) {
+			c.op = op
+			p.pos += len(op)
+			break
+		}
+	}
+	if c.op == "" {
+		return nil, fmt.Errorf("expected an operator after %s", c.key)
+	}
+
+	value, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	c.value = value
+	switch c.op {
+	case "~", "!~":
+		if c.re, err = regexp.Compile(value); err != nil {
+			return nil, err
+		}
+	default:
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			c.num, c.isNum = f, true
+		}
+	}
+	return c, nil
+}
+
+// value reads a comparison value: either a double quoted string, in
+// which \" and \\ are escapes, or text up to the next space or
+// parenthesis.
+func (p *filterParser) value() (string, error) {
+	if p.pos < len(p.s) && p.s[p.pos] == '"' {
+		var b strings.Builder
+		for i := p.pos + 1; i < len(p.s); i++ {
+			switch ch := p.s[i]; {
+			case ch == '\\' && i+1 < len(p.s):
+				i++
+				b.WriteByte(p.s[i])
+			case ch == '"':
+				p.pos = i + 1
+				return b.String(), nil
+			default:
+				b.WriteByte(ch)
+			}
+		}
+		return "", fmt.Errorf("unterminated quoted value")
+	}
+	start := p.pos
+	for p.pos < len(p.s) && !strings.ContainsRune(" ()", rune(p.s[p.pos])) {
+		p.pos++
+	}
+	return p.s[start:p.pos], nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFilterNumericKinds(t *testing.T) {
+	values := []interface{}{
+		json.Number("3"), 3.0, float32(3), "3", " 3 ",
+		3, int8(3), int16(3), int32(3), int64(3),
+		uint(3), uint8(3), uint16(3), uint32(3), uint64(3),
+	}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"n>=2", true},
+		{"n>3", false},
+		{"n=3", true},
+		{"n!=3", false},
+		{"n<3.5", true},
+	}
+
+	for _, tt := range tests {
+		e, err := parseFilter(tt.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range values {
+			if got := e.match(map[string]interface{}{"n": v}); got != tt.want {
+				t.Errorf("%s on %T %v = %t, want %t", tt.expr, v, v, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		expr string
+		rec  string
+		want bool
+	}{
+		{"level=error", `{"level":"error"}`, true},
+		{"level=error", `{"level":"info"}`, false},
+		{"status>=500", `{"status":503}`, true},
+		{"status>=500", `{"status":404}`, false},
+		{"status>=500", `{"status":"n/a"}`, false},
+		{"status!=500", `{"status":"n/a"}`, true},
+		{"msg~timeout", `{"msg":"read timeout after 3s"}`, true},
+		{"msg!~timeout", `{"msg":"read timeout after 3s"}`, false},
+		{"missing=x", `{}`, false},
+		{"missing!=x", `{}`, true},
+		{"http.status>=500", `{"http":{"status":500}}`, true},
+		{`msg="a b"`, `{"msg":"a b"}`, true},
+		{"time>=2024-05-01", `{"time":"2024-05-01T10:00:00Z"}`, true},
+		{"level=error AND status>=500", `{"level":"error","status":200}`, false},
+		{"level=error OR status>=500", `{"level":"info","status":502}`, true},
+		{"(level=warn OR level=error) && status<300", `{"level":"warn","status":200}`, true},
+	}
+
+	for _, tt := range tests {
+		e, err := parseFilter(tt.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := decodeTestRecord(t, tt.rec)
+		if got := e.match(rec); got != tt.want {
+			t.Errorf("%s on %s = %t, want %t", tt.expr, tt.rec, got, tt.want)
+		}
+	}
+}
+
+func TestFilterArrayModeCount(t *testing.T) {
+	e, err := parseFilter("errors>=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := decodeTestRecord(t, `{"errors":["a","b","c"]}`)
+	summarizeArrays(rec, "count")
+	if !e.match(rec) {
+		t.Errorf("errors>=2 doesn't match %v", rec)
+	}
+}
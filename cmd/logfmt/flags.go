@@ -0,0 +1,16 @@
+package main
+
+import "strings"
+
+// stringsFlag is a flag.Value that collects every occurrence of a
+// repeatable flag.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// followPollInterval is how often -follow checks a file for new data.
+const followPollInterval = 250 * time.Millisecond
+
+// followReader reads a file like tail -F: at EOF it waits for more
+// data instead of returning io.EOF, reopens the path when the file is
+// replaced (e.g. by log rotation) and starts over when it is truncated.
+type followReader struct {
+	path string
+	f    *os.File
+}
+
+// openFollow opens path for -follow, positioned at its end so that only
+// records appended from now on are read.
+func openFollow(path string) (*followReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &followReader{path: path, f: f}, nil
+}
+
+func (r *followReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.f.Read(p)
+		if n > 0 || (err != nil && err != io.EOF) {
+			return n, err
+		}
+
+		// at EOF: check whether the file was replaced or truncated
+		if cur, err := r.f.Stat(); err == nil {
+			if fi, err := os.Stat(r.path); err == nil && !os.SameFile(cur, fi) {
+				// the old file may have grown between the read above and
+				// its rename, so read it to the end before moving on
+				if n, err := r.f.Read(p); n > 0 || (err != nil && err != io.EOF) {
+					return n, err
+				}
+				if f, err := os.Open(r.path); err == nil {
+					infof("%s was replaced, reopening", r.path)
+					r.f.Close()
+					r.f = f
+					continue
+				}
+			}
+			if offset, err := r.f.Seek(0, io.SeekCurrent); err == nil && cur.Size() < offset {
+				infof("%s was truncated, reading from the start", r.path)
+				if _, err := r.f.Seek(0, io.SeekStart); err != nil {
+					return 0, err
+				}
+				continue
+			}
+		}
+		time.Sleep(followPollInterval)
+	}
+}
+
+func (r *followReader) Close() error {
+	return r.f.Close()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFollowReader(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	if err := os.WriteFile(path, []byte("before\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := openFollow(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	br := bufio.NewReader(r)
+
+	lines := make(chan string)
+	go func() {
+		for {
+			l, err := br.ReadString('\n')
+			if err != nil {
+				close(lines)
+				return
+			}
+			lines <- l
+		}
+	}()
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case got, ok := <-lines:
+			if !ok {
+				t.Fatalf("reader stopped, want %q", want)
+			}
+			if got != want {
+				t.Fatalf("read %q, want %q", got, want)
+			}
+		case <-time.After(10 * followPollInterval):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+	appendLine := func(p, s string) {
+		t.Helper()
+		f, err := os.OpenFile(p, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// only lines appended after opening are read
+	appendLine(path, "appended\n")
+	expect("appended\n")
+
+	// rotation: the old file is renamed away and a new one created;
+	// the rest of the old file is read before switching
+	appendLine(path, "last in old\n")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendLine(path, "first in new\n")
+	expect("last in old\n")
+	expect("first in new\n")
+
+	// truncation: the file is cut short and rewritten in place
+	if err := os.WriteFile(path, []byte("short\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expect("short\n")
+	appendLine(path, "after truncate\n")
+	expect("after truncate\n")
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/psanford/logfmt/convert"
+)
+
+// ansiMatch highlights -grep matches, in the bold red grep uses.
+const ansiMatch = "\x1b[1;31m"
+
+// recordGrep is -grep or -grep-v: a regex matched against the record's
+// rendered line, or with field against that field's plain text.
+type recordGrep struct {
+	re     *regexp.Regexp
+	field  string
+	invert bool
+}
+
+func newRecordGrep(expr, field string, invert bool) (*recordGrep, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &recordGrep{re: re, field: field, invert: invert}, nil
+}
+
+// match reports whether a record passes the grep. A record without the
+// field doesn't match.
+func (g *recordGrep) match(rec map[string]interface{}, line string) bool {
+	text := line
+	if g.field != "" {
+		parent, leaf, ok := lookupPath(rec, g.field)
+		if !ok {
+			return g.invert
+		}
+		text = ""
+		if v := parent[leaf]; v != nil {
+			text = convert.PlainValue(v)
+		}
+	}
+	return g.re.MatchString(text) != g.invert
+}
+
+// highlight marks the matches within each field's key and value, or
+// only within the value of the -grep-field. A match spanning fields
+// isn't marked.
+func (g *recordGrep) highlight(fields []field, opts convert.Options, maxKeyLen int) {
+	key := ""
+	if g.field != "" {
+		key = shortenKey(opts.FormatKey(g.field), maxKeyLen)
+	}
+	for i := range fields {
+		f := &fields[i]
+		if key != "" {
+			if f.key == key {
+				f.valueMatches = g.matches(f.value)
+			}
+			continue
+		}
+		f.keyMatches = g.matches(f.key)
+		if !f.bare {
+			f.valueMatches = g.matches(f.value)
+		}
+	}
+}
+
+// matches returns the non-empty matches in s.
+func (g *recordGrep) matches(s string) [][]int {
+	var out [][]int
+	for _, m := range g.re.FindAllStringIndex(s, -1) {
+		if m[1] > m[0] {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+func (g *recordGrep) String() string {
+	s := g.re.String()
+	if g.field != "" {
+		s += " in " + g.field
+	}
+	return s
+}
+
+// paintMatches is paint for text with highlighted matches: the text
+// between them keeps color.
+func paintMatches(color, s string, matches [][]int) string {
+	if len(matches) == 0 {
+		return paint(color, s)
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		if m[0] > last {
+			b.WriteString(paint(color, s[last:m[0]]))
+		}
+		b.WriteString(paint(ansiMatch, s[m[0]:m[1]]))
+		last = m[1]
+	}
+	if last < len(s) {
+		b.WriteString(paint(color, s[last:]))
+	}
+	return b.String()
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// humanizer renders byte counts and durations in a readable form for
+// -humanize, -bytes-field and -duration-field, e.g. 1.5MB or 250ms.
+// With heuristic set, fields are also picked by name: *_bytes, bytes,
+// size and *_size are byte counts, *_ns, *_us, *_ms and *_s durations
+// in that unit, and latency, duration and elapsed durations in seconds.
+// The output never needs quoting.
+type humanizer struct {
+	heuristic bool
+	durations map[string]time.Duration
+	bytes     map[string]bool
+}
+
+// durationUnits maps the -duration-field unit names, and the key
+// suffixes recognized by -humanize, to their length.
+var durationUnits = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+}
+
+// parseDurationFields parses -duration-field entries of the form
+// field[:unit], with unit defaulting to seconds.
+func parseDurationFields(list string) (map[string]time.Duration, error) {
+	fields := make(map[string]time.Duration)
+	for _, f := range splitList(list) {
+		unit := "s"
+		if i := strings.LastIndexByte(f, ':'); i >= 0 {
+			f, unit = f[:i], f[i+1:]
+		}
+		d, ok := durationUnits[unit]
+		if !ok {
+			return nil, fmt.Errorf("unknown -duration-field unit %q (expected ns, us, ms or s)", unit)
+		}
+		fields[f] = d
+	}
+	return fields, nil
+}
+
+// format renders v humanized if key is a byte or duration field and v
+// is a number.
+func (h *humanizer) format(key string, v interface{}) (string, bool) {
+	if _, ok := v.(string); ok {
+		return "", false
+	}
+	f, ok := numericValue(v)
+	if !ok {
+		return "", false
+	}
+	if unit, ok := h.durationUnit(key); ok {
+		return humanizeDuration(time.Duration(f * float64(unit))), true
+	}
+	if h.isBytes(key) && f >= 0 {
+		return humanizeBytes(f), true
+	}
+	return "", false
+}
+
+func (h *humanizer) durationUnit(key string) (time.Duration, bool) {
+	if unit, ok := h.durations[key]; ok {
+		return unit, true
+	}
+	if !h.heuristic {
+		return 0, false
+	}
+	name := strings.ToLower(lastSegment(key))
+	switch name {
+	case "latency", "duration", "elapsed":
+		return time.Second, true
+	}
+	if i := strings.LastIndexByte(name, '_'); i >= 0 {
+		if unit, ok := durationUnits[name[i+1:]]; ok {
+			return unit, true
+		}
+	}
+	return 0, false
+}
+
+func (h *humanizer) isBytes(key string) bool {
+	if h.bytes[key] {
+		return true
+	}
+	if !h.heuristic {
+		return false
+	}
+	name := strings.ToLower(lastSegment(key))
+	return name == "bytes" || name == "size" || strings.HasSuffix(name, "_bytes") || strings.HasSuffix(name, "_size")
+}
+
+// lastSegment returns the part of a dotted, flattened key after the
+// last dot.
+func lastSegment(key string) string {
+	return key[strings.LastIndexByte(key, '.')+1:]
+}
+
+// humanizeDuration rounds d to three or so significant digits.
+func humanizeDuration(d time.Duration) string {
+	abs := d
+	if abs < 0 {
+		abs = -abs
+	}
+	switch {
+	case abs >= time.Second:
+		d = d.Round(10 * time.Millisecond)
+	case abs >= time.Millisecond:
+		d = d.Round(10 * time.Microsecond)
+	case abs >= time.Microsecond:
+		d = d.Round(10 * time.Nanosecond)
+	}
+	return d.String()
+}
+
+var byteUnits = []string{"B", "KB", "MB", "GB", "TB", "PB", "EB"}
+
+// humanizeBytes renders n with a decimal (1000 based) unit.
+func humanizeBytes(n float64) string {
+	i := 0
+	for n >= 1000 && i < len(byteUnits)-1 {
+		n /= 1000
+		i++
+	}
+	if i == 0 {
+		return strconv.FormatFloat(n, 'f', -1, 64) + byteUnits[0]
+	}
+	s := strconv.FormatFloat(n, 'f', 1, 64)
+	return strings.TrimSuffix(s, ".0") + byteUnits[i]
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// jsonEscapeHTML is whether JSON output escapes <, > and & as
+// encoding/json does by default. It is cleared by -no-html-escape.
+var jsonEscapeHTML = true
+
+// marshalJSON is json.Marshal honoring jsonEscapeHTML.
+func marshalJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(jsonEscapeHTML)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// orderedRecord marshals a record as a JSON object with its top level keys
+// in the given order. Nested objects are marshaled by encoding/json, which
+// sorts their keys.
+type orderedRecord struct {
+	rec  map[string]interface{}
+	keys []string
+}
+
+func (r orderedRecord) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range r.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		kb, err := marshalJSON(k)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(kb)
+		buf.WriteByte(':')
+		vb, err := marshalJSON(r.rec[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(vb)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// formatJSONRecord encodes rec as compact JSON, or indented JSON when
+// pretty is set. prefix is added to the start of every line, for
+// nesting the record inside a -json-array.
+func formatJSONRecord(rec map[string]interface{}, sortedFields []string, pretty bool, prefix string) (string, error) {
+	b, err := marshalJSON(orderedRecord{rec: rec, keys: sortedFields})
+	if err != nil {
+		return "", err
+	}
+	if pretty {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, b, prefix, "  "); err != nil {
+			return "", err
+		}
+		return prefix + buf.String(), nil
+	}
+	return prefix + string(b), nil
+}
+
+// jsonArray wraps output records in a single JSON array, delaying each
+// record until the next arrives so that every element but the last is
+// followed by a comma.
+type jsonArray struct {
+	pending *string
+}
+
+// add returns the lines that can be written for a new element.
+func (a *jsonArray) add(line string) []string {
+	if a.pending == nil {
+		a.pending = &line
+		return []string{"["}
+	}
+	prev := *a.pending + ","
+	a.pending = &line
+	return []string{prev}
+}
+
+// finish returns the lines that close the array.
+func (a *jsonArray) finish() []string {
+	if a.pending == nil {
+		return []string{"[]"}
+	}
+	last := *a.pending
+	a.pending = nil
+	return []string{last, "]"}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/psanford/logfmt/convert"
+)
+
+// severity is a normalized log level. Higher is more severe.
+type severity int
+
+const (
+	sevTrace severity = iota
+	sevDebug
+	sevInfo
+	sevWarn
+	sevError
+	sevFatal
+)
+
+var severityNames = map[string]severity{
+	"trace": sevTrace,
+	"debug": sevDebug,
+	"info":  sevInfo,
+	"warn":  sevWarn,
+	"error": sevError,
+	"fatal": sevFatal,
+}
+
+// defaultLevels maps common level spellings, including numeric bunyan
+// levels, onto severities.
+var defaultLevels = map[string]severity{
+	"trace": sevTrace,
+	"trc":   sevTrace,
+
+	"debug": sevDebug,
+	"dbg":   sevDebug,
+
+	"info":          sevInfo,
+	"inf":           sevInfo,
+	"information":   sevInfo,
+	"informational": sevInfo,
+	"notice":        sevInfo,
+
+	"warn":    sevWarn,
+	"wrn":     sevWarn,
+	"warning": sevWarn,
+
+	"error":  sevError,
+	"err":    sevError,
+	"eror":   sevError,
+	"dpanic": sevError,
+
+	"fatal":     sevFatal,
+	"ftl":       sevFatal,
+	"crit":      sevFatal,
+	"critical":  sevFatal,
+	"panic":     sevFatal,
+	"alert":     sevFatal,
+	"emerg":     sevFatal,
+	"emergency": sevFatal,
+
+	// bunyan and pino
+	"10": sevTrace,
+	"20": sevDebug,
+	"30": sevInfo,
+	"40": sevWarn,
+	"50": sevError,
+	"60": sevFatal,
+}
+
+// numericLevels are the meanings of small integer levels, which differ
+// between syslog and zap, selected by -level-numbers.
+var numericLevels = map[string]map[string]severity{
+	"syslog": {
+		"0": sevFatal,
+		"1": sevFatal,
+		"2": sevFatal,
+		"3": sevError,
+		"4": sevWarn,
+		"5": sevInfo,
+		"6": sevInfo,
+		"7": sevDebug,
+	},
+	"zap": {
+		"-1": sevDebug,
+		"0":  sevInfo,
+		"1":  sevWarn,
+		"2":  sevError,
+		"3":  sevError, // dpanic
+		"4":  sevFatal, // panic
+		"5":  sevFatal,
+	},
+}
+
+func parseSeverity(name string) (severity, error) {
+	sev, ok := severityNames[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown level %q (expected trace, debug, info, warn, error or fatal)", name)
+	}
+	return sev, nil
+}
+
+// levelDetector finds and classifies the level of a record.
+type levelDetector struct {
+	fields []string
+	levels map[string]severity
+}
+
+// newLevelDetector builds a levelDetector checking fields in order.
+// numbers names the numericLevels used for small integers. overrides
+// is a comma separated list of spelling=level pairs added to (or
+// replacing entries in) the default level table.
+func newLevelDetector(fields []string, numbers, overrides string) (*levelDetector, error) {
+	nums, ok := numericLevels[numbers]
+	if !ok {
+		return nil, fmt.Errorf("unknown -level-numbers %q (expected syslog or zap)", numbers)
+	}
+	levels := make(map[string]severity, len(defaultLevels)+len(nums))
+	for k, v := range defaultLevels {
+		levels[k] = v
+	}
+	for k, v := range nums {
+		levels[k] = v
+	}
+
+	if overrides != "" {
+		for _, pair := range strings.Split(overrides, ",") {
+			idx := strings.Index(pair, "=")
+			if idx < 1 {
+				return nil, fmt.Errorf("invalid -levels entry %q, expected spelling=level", pair)
+			}
+			sev, err := parseSeverity(pair[idx+1:])
+			if err != nil {
+				return nil, err
+			}
+			levels[strings.ToLower(pair[:idx])] = sev
+		}
+	}
+
+	return &levelDetector{fields: fields, levels: levels}, nil
+}
+
+// severity returns the severity of rec, or false if it has no
+// recognized level.
+func (d *levelDetector) severity(rec map[string]interface{}) (severity, bool) {
+	_, sev, ok := d.find(rec)
+	return sev, ok
+}
+
+// find is severity but also returns the field holding the level, if
+// there is one.
+func (d *levelDetector) find(rec map[string]interface{}) (key string, sev severity, ok bool) {
+	for _, f := range d.fields {
+		v, ok := rec[f]
+		if !ok || v == nil {
+			continue
+		}
+		sev, ok := d.levels[strings.ToLower(convert.PlainValue(v))]
+		return f, sev, ok
+	}
+	return "", 0, false
+}
@@ -0,0 +1,1163 @@
+// Copyright Peter Sanford 2021
+// Parts of logfmt are derived from https://github.com/inconshreveable/log15 and copyright 2014 Alan Shreve
+
+// Command logfmt converts JSON log records to logfmt. Install it with
+//
+//	go install github.com/psanford/logfmt/cmd/logfmt@latest
+//
+// The conversion itself is in the convert package, for use from other
+// programs.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/psanford/logfmt/convert"
+)
+
+var (
+	templateFlag  = flag.String("template", "", "Write each record with a Go text/template, e.g. '{{.time}} [{{.level | upper}}] {{.msg}} {{rest .}}'; fields are plain text, and the functions upper, lower, pad N, padLeft N, trunc N, default X and rest (the other fields as logfmt) are available")
+	pretty        = flag.Bool("pretty", false, "Write each record across several lines: time, level and message on a header line, then each other field indented, with long and multi-line strings unescaped as blocks (same as -format=pretty)")
+	canonicalize  = flag.Bool("canonicalize", false, "Write a deterministic logfmt form for hashing and comparison: keys sorted bytewise ignoring -order, strings always quoted, numbers normalized, nested values as sorted compact JSON (same as -format=canonical)")
+	hashField     = flag.String("hash-field", "", "Add a field with this name holding the SHA-256 of the record's -canonicalize form, e.g. for -uniq-by over whole records")
+	keyPrefix     = flag.String("key-prefix", "", "Prefix every key with this string after all other transforms; -order, -uniq-by and -group-by then match the prefixed names. {file} is replaced by the name of the input the record came from, to namespace each file's keys differently")
+	order         = flag.String("order", "time,msg", "Order of fields (missing will be sorted bytewise after this list; fields after a ... entry are pinned to the end)")
+	preserveOrder = flag.Bool("preserve-order", false, "Write fields not placed by -order in the order the JSON input has them instead of sorted; -order then defaults to empty")
+	orderLast     = flag.String("order-last", "", "Comma separated fields to place at the end of the line, in this order, after all others; takes precedence over -order")
+	orderTiebreak = flag.String("order-tiebreak", "lexical", "How fields not named in -order are sorted: lexical or natural (item2 before item10, and integer keys such as 2 before 10)")
+
+	contextAfter      = flag.Int("A", 0, "Also write this many records after each record the filters select, like grep -A: -filter, -grep, -grep-v, -line-grep, -line-grep-v, -min-level, -require and -require-any select records")
+	contextBefore     = flag.Int("B", 0, "Also write this many records before each selected record, like grep -B")
+	contextBoth       = flag.Int("C", 0, "Same as -A and -B with this number, unless they are given")
+	grepExpr          = flag.String("grep", "", "Only write records whose output line (or -grep-field) matches this regex, highlighting the matches when coloring logfmt output")
+	grepV             = flag.String("grep-v", "", "Drop records whose output line (or -grep-field) matches this regex")
+	grepField         = flag.String("grep-field", "", "Match -grep and -grep-v against the plain text of this field (a dotted path into nested objects is allowed) instead of the whole line")
+	lineGrep          = flag.String("line-grep", "", "Only print output lines matching this regex")
+	lineGrepV         = flag.String("line-grep-v", "", "Drop output lines matching this regex")
+	blankBetween      = flag.Bool("blank-between", false, "Write an empty line between records")
+	blankBetweenFiles = flag.Bool("blank-between-files", false, "Write an empty line between the records of different input files")
+	emitMeta          = flag.Bool("emit-meta", false, "Prefix each line with the record's source position, outside its key=value pairs")
+	metaFormatFlag    = flag.String("meta-format", "[{file}:{line}]", "Format of the -emit-meta prefix; {file}, {line} and {seq} (record number) are replaced")
+	dropEmptyRecords  = flag.Bool("drop-empty-records", false, "Drop records left with no fields after all transforms (including -delta) instead of writing an empty line")
+	windowSize        = flag.Duration("window", 0, "Write one summary record per window of this length (e.g. 10s) by -time-field instead of the records themselves")
+	aggSpecs          = flag.String("agg", "count", "Comma separated -window aggregates: count, or sum, avg, min or max of a numeric field as op:field (e.g. count,avg:latency)")
+	deltaFlag         = flag.Bool("delta", false, "Only write the fields whose value changed since the previous record, plus the -order and -time-field fields; the first record is written whole")
+	deltaShowRemoved  = flag.Bool("delta-removed", false, "With -delta, write fields missing since the previous record as key=∅")
+	maxKeyLen         = flag.Int("max-key-len", 0, "Truncate logfmt keys longer than N characters, ending them with a hash of the full key so distinct keys stay distinct (0 for no limit)")
+	maxFields         = flag.Int("max-fields", 0, "Only output the first N fields after ordering; logfmt output ends with a …+M marker counting the dropped fields (0 for no limit)")
+	colorMode         = flag.String("color", "auto", "Color logfmt and pretty-json output: keys dimmed, values bright and the -level-field value by severity (auto|always|never); auto colors a terminal unless NO_COLOR is set")
+	format            = flag.String("format", "logfmt", "Output format (logfmt|json|pretty|pretty-json|canonical|template); pretty writes each field on its own line under a time, level and message header, pretty-json is indented and colored on a terminal")
+
+	arrayMode = flag.String("array-mode", "value", "How to render array values: value, count (number of elements) or counts (value:count for each distinct element)")
+
+	collapseWS       = flag.Bool("collapse-ws", false, "Collapse runs of spaces and tabs in string values to a single space")
+	collapseNewlines = flag.Bool("collapse-newlines", false, "With -collapse-ws, also collapse line breaks")
+
+	replaces     stringsFlag
+	replaceField = flag.String("replace-field", "", "Comma separated fields -replace applies to (default all string values)")
+
+	groupDigitsFlag = flag.Bool("group-digits", false, "Render integers with thousands separators (not machine parseable as numbers)")
+	digitSeparator  = flag.String("digit-separator", ",", "Separator used by -group-digits; _ keeps values free of punctuation other parsers may dislike")
+
+	asString        = flag.String("as-string", "", "Comma separated fields to always render as quoted strings")
+	humanize        = flag.Bool("humanize", false, "Render numeric fields that look like byte counts (*_bytes, size) or durations (*_ms, *_ns, latency in seconds) readably, e.g. 1.5MB or 250ms")
+	durationFields  = flag.String("duration-field", "", "Comma separated fields to render as durations, each as field[:unit] with unit ns, us, ms or s (default s)")
+	bytesFields     = flag.String("bytes-field", "", "Comma separated fields to render as byte counts")
+	numbersAsString = flag.Bool("numbers-as-string", false, "Render every JSON number as a quoted string holding its exact input text; -as-number fields are still rendered bare")
+	asNumber        = flag.String("as-number", "", "Comma separated fields to render as bare numbers when their value parses as one")
+
+	floatPrecision  = flag.Int("float-precision", 3, "Decimal places to write floats with, or -1 for the shortest form that round-trips. Unless this is given, numbers decoded from JSON are written as they appear in the input; integers always are")
+	quoteCharFlag   = flag.String("quote-char", `"`, "Character used to quote values, escaped with a backslash inside them")
+	invalidUTF8Flag = flag.String("invalid-utf8", "replace", "How to render invalid UTF-8 in values (replace|escape|strip)")
+
+	jsonPretty   = flag.Bool("json-pretty", false, "With -format=json, indent each record")
+	noHTMLEscape = flag.Bool("no-html-escape", false, "In JSON output, write <, > and & as is instead of as \\u003c, \\u003e and \\u0026")
+	jsonArr      = flag.Bool("json-array", false, "With -format=json, wrap all records in a single JSON array")
+
+	skipErrors        = flag.Bool("skip-errors", false, "Decode one record per line and skip lines that are not valid JSON")
+	textAs            = flag.String("text-as", "", "Decode one record per line and wrap lines that are not JSON objects as a record with the line under this key")
+	inputGlob         = flag.String("glob", "", "Also read the files matching this pattern (e.g. 'logs/*.json.gz'), expanded internally in sorted order; gzip and zstd files are decompressed")
+	mergeByTime       = flag.Bool("merge-by-time", false, "Read all inputs at once and interleave their records by -time-field; each input must already be in time order")
+	keepGoing         = flag.Bool("keep-going", false, "Skip input files that can't be opened, and the rest of a file after a fatal decode error, instead of stopping")
+	tagSource         = flag.String("tag-source", "", "Add a field with this name holding the input file name to every record")
+	rootPointer       = flag.String("root", "", "JSON pointer (e.g. /records) to the records within each input document; an array there is read as a stream of records")
+	follow            = flag.Bool("follow", false, "Keep reading the input file as it grows, like tail -F, starting at its current end and reopening it when it is rotated or truncated")
+	docker            = flag.Bool("docker", false, "Unwrap Docker json-file log entries ({\"log\":...,\"stream\":...,\"time\":...}), decoding the log line as JSON if it is an object (otherwise as msg) and adding the envelope fields, as docker_<name> on a clash")
+	reverse           = flag.Bool("reverse", false, "Read logfmt lines instead of JSON, writing JSON unless -format is given; quoted values are strings and bare true, false, nil and numbers keep their types")
+	inputFraming      = flag.String("input-framing", "none", "How input records are delimited: none (any whitespace, with the elements of a top level array read as records), newline (one record per line) or rs (RFC 7464 JSON text sequences, records preceded by 0x1e)")
+	passthrough       = flag.Bool("passthrough", false, "Decode one record per line and write lines that are not valid JSON, such as stack traces, verbatim in place; implies -skip-errors")
+	passthroughStderr = flag.Bool("passthrough-stderr", false, "Like -passthrough but write the lines that are not valid JSON to stderr")
+	errorField        = flag.Bool("error-field", false, "With -skip-errors, emit an error=... raw=... line for each invalid input line")
+
+	execCommand = flag.String("exec", "", "Pipe each record as a JSON line through this long running shell command, which must reply with one JSON line (or null) per record")
+
+	parseJSONFields = flag.String("parse-json-field", "", "Comma separated fields whose string values may hold encoded JSON objects to decode")
+	parseJSONNest   = flag.Bool("parse-json-nest", false, "With -parse-json-field, nest the decoded object under its field instead of merging it into the record")
+
+	numericKeys     = flag.String("numeric-keys", "string", "How to treat nested objects whose keys are exactly 0 to n-1: string keeps them as objects with plain string keys, array turns them into arrays (e.g. for -flatten-arrays and -array-mode)")
+	flatten         = flag.Bool("flatten", false, "Flatten nested objects into dotted keys (a.b.c=v)")
+	flattenArrays   = flag.Bool("flatten-arrays", false, "Also flatten arrays, keying elements by index (a.0.b=v); implies -flatten")
+	flattenMaxDepth = flag.Int("flatten-max-depth", 0, "Stop flattening after this many levels of nesting, keeping deeper values whole (0 for no limit)")
+	flattenPrefix   = flag.String("flatten-prefix", "", "With -flatten, prefix keys built from nested values (e.g. ctx. turns http.method into ctx.http.method); top level keys are unchanged")
+	rawJSON         = flag.String("raw-json", "", "Comma separated fields to emit as compact JSON strings instead of flattening")
+
+	sets     stringsFlag
+	setForce = flag.Bool("set-force", false, "Let -set values replace fields already present in the record")
+
+	folds            stringsFlag
+	renames          stringsFlag
+	lookups          stringsFlag
+	timeInputFormats stringsFlag
+	lookupDef        = flag.String("lookup-default", "", "Value to emit for -lookup misses (by default misses add no field)")
+	normalize        = flag.Bool("normalize", false, "Rename common variants of the time, level and message keys (ts, @timestamp, timestamp; log.level, severity, lvl; message) to time, level and msg, unless the record already has them")
+	onCollision      = flag.String("on-collision", "last", "What to do when a transform produces an existing key (last|first|error|merge)")
+
+	timeField    = flag.String("time-field", "time", "Comma separated candidate fields holding the record timestamp (each may be a dotted path into nested objects); the first present one that parses as a time is used")
+	timeLayout   = flag.String("time-format", "", "Re-render -time-field using this Go time layout (e.g. 2006-01-02T15:04:05.000Z07:00)")
+	timeZone     = flag.String("time-zone", "", "Render -time-field in this zone: UTC, Local or a name such as America/New_York (implies -time-format=RFC3339 if not given; by default each time keeps its own offset)")
+	timeRelative = flag.Bool("time-relative", false, "Render -time-field as the offset from the first written record's time, e.g. +1.230s")
+	sinceFlag    = flag.String("since", "", "Only write records whose -time-field is at or after this time: a timestamp, a time of day such as 10:30 (today, in -time-zone or local time), or a duration relative to now such as -15m. Records without a parseable time are dropped")
+	untilFlag    = flag.String("until", "", "Only write records whose -time-field is before this time, given like -since; a bare time of day is on the day of -since if set")
+	timeSince    = flag.String("time-since", "", "Render -time-field as a duration such as +12ms or +3.4s since the previous record (prev), the first record (first) or a fixed time given as for -since")
+
+	minLevel         = flag.String("min-level", "", "Drop records below this level (trace|debug|info|warn|error|fatal)")
+	levelField       = flag.String("level-field", "level,severity", "Fields to check (in order) for the record level")
+	syslogOut        = flag.Bool("syslog", false, "Write records to syslog instead of stdout, at the priority given by -level-field")
+	syslogAddr       = flag.String("syslog-addr", "", "Syslog server as [network://]host:port for -syslog, default the local syslog daemon (implies -syslog)")
+	syslogTag        = flag.String("syslog-tag", "logfmt", "Tag for messages written with -syslog")
+	levelsMapping    = flag.String("levels", "", "Additional level spellings, e.g. notice=warn,10=trace")
+	levelNumbers     = flag.String("level-numbers", "syslog", "How to read small integer levels: syslog (0=emerg ... 7=debug) or zap (-1=debug ... 5=fatal); bunyan levels 10-60 are always recognized")
+	keepUnknownLevel = flag.Bool("keep-unknown-level", true, "With -min-level, keep records with a missing or unrecognized level")
+
+	headN      = flag.Int("head", 0, "Stop after writing this many records (0 for no limit)")
+	tailN      = flag.Int("tail", 0, "Only write the last N records, held in memory until the end of the input (0 for all)")
+	sampleRate = flag.Float64("sample", 1, "Write each record that passes all filters with this probability (0-1)")
+	sampleSeed = flag.Int64("sample-seed", 0, "Seed for -sample, for reproducible output (0 picks a random seed)")
+
+	onlyFields    = flag.String("only", "", "Comma separated fields to keep, dropping all others; nested fields are matched by their dotted path and glob patterns such as http.* are allowed, where * also matches dots and slashes")
+	excludeFields = flag.String("exclude", "", "Comma separated fields to drop, e.g. caller,stacktrace; nested fields are matched by their dotted path and glob patterns such as kubernetes.* are allowed, where * also matches dots and slashes")
+	redactFields  = flag.String("redact", "", "Comma separated fields whose values are replaced with [REDACTED], matched case insensitively; glob patterns such as *.secret are allowed and match keys inside nested objects and arrays, where * also matches dots and slashes")
+	redactMode    = flag.String("redact-mode", "mask", "How -redact replaces values: mask writes [REDACTED], hash a short SHA-256 of the value so equal values stay correlatable")
+	requireAll    = flag.String("require", "", "Comma separated fields that must all be present for a record to be written")
+	requireAny    = flag.String("require-any", "", "Comma separated fields of which at least one must be present for a record to be written")
+	filters       stringsFlag
+
+	uniqBy   = flag.String("uniq-by", "", "Comma separated fields; only write one record per distinct combination of their values (all combinations are held in memory)")
+	uniqKeep = flag.String("uniq-keep", "first", "Which duplicate -uniq-by keeps (first|last); last buffers all output until EOF")
+
+	groupBy = flag.String("group-by", "", "Write a '== key=value ==' header whenever this field's value changes; input is assumed sorted by it, otherwise a header is repeated each time the value changes")
+
+	parallel    = flag.Int("parallel", 0, "Split the input into lines and decode them on this many goroutines, writing records in input order; implies -input-framing=newline and, unless given, -concurrency of the same number")
+	concurrency = flag.Int("concurrency", 1, "Number of goroutines used to format records")
+
+	quiet   = flag.Bool("quiet", false, "Only report fatal errors on stderr")
+	verbose = flag.Bool("verbose", false, "Report progress and statistics on stderr")
+
+	align       = flag.Bool("align", false, "Lay fields out in columns by key across records, leaving a column blank where a record lacks the key")
+	alignWindow = flag.Int("align-window", 100, "Number of records buffered to compute -align columns; 0 buffers the whole input. With -follow, buffered records are also written once the input goes quiet")
+
+	wrap = flag.String("wrap", "", "Wrap lines wider than N columns between fields, indenting continuations; auto uses $COLUMNS when stdout is a terminal. Wrapped output is not machine parseable")
+
+	expand           = flag.Bool("expand", false, "Write each field of a record on its own line, with an empty line between records")
+	padKeys          = flag.Bool("pad-keys", false, "With -expand, pad keys to the widest in each record so the = signs line up")
+	limitBytes       = flag.Int64("limit-bytes", 0, "Stop once this many bytes have been written, without writing a partial line, and exit with status 4 (0 for no limit)")
+	outputBufferSize = flag.Int("output-buffer-size", 64*1024, "Size in bytes of the output write buffer")
+
+	bench = flag.Bool("bench", false, "Run the full pipeline discarding output and report throughput on stderr")
+
+	preset = flag.String("preset", "", "Default -order, -time-field and -level-field for a logging library (zap|logrus|slog|bunyan); explicit flags take precedence")
+
+	check    = flag.Bool("check", false, "Only validate the input, reporting the first JSON error and exiting nonzero if there is one")
+	checkAll = flag.Bool("check-all", false, "Like -check but decode one record per line and report every invalid line")
+
+	warnEmpty = flag.Bool("warn-empty", false, "Report on stderr and exit with status 3 if the input holds no records")
+
+	failOnEmpty    = flag.Bool("fail-on-empty", false, "Exit with status 5 if no records were written after filtering")
+	failOnNonempty = flag.Bool("fail-on-nonempty", false, "Exit with status 5 if any records were written after filtering")
+
+	dryRun = flag.Bool("dry-run", false, "Print the effective configuration to stderr and exit without reading input")
+)
+
+func main() {
+	flag.IntVar(headN, "n", 0, "Alias for -head")
+	flag.BoolVar(follow, "f", false, "Alias for -follow")
+	flag.Var(&sets, "set", "Add a constant key=value field to every record (repeatable)")
+	flag.Var(&filters, "filter", "Only write records matching an expression such as level=error, status>=500 or msg~timeout; combine with AND, OR and parentheses, quote values with spaces (repeatable, all must match)")
+	flag.Var(&timeInputFormats, "time-input-format", "Go time layout to try, before the built in ones, when parsing -time-field strings, e.g. '02/Jan/2006:15:04:05 -0700' (repeatable)")
+	flag.Var(&lookups, "lookup", "Map a field through a two column TSV file, adding field_text: field:file[:outkey] (repeatable)")
+	flag.Var(&replaces, "replace", "Regex substitution /regex/replacement/ on string values, $1 refers to a capture group (repeatable)")
+	flag.Var(&renames, "rename", "Rename a field, old=new; old may be a dotted path into nested objects (repeatable, applied before -normalize)")
+	flag.Var(&folds, "fold", "Add a field built from a template of other fields, e.g. endpoint='{method} {path}' (repeatable)")
+	flag.Usage = usage
+	// logfmt stats [flags] <file|->... summarizes the records instead
+	// of writing them
+	statsMode := len(os.Args) > 1 && os.Args[1] == "stats"
+	if statsMode {
+		registerStatsFlags()
+		flag.CommandLine.Parse(os.Args[2:])
+	} else {
+		flag.Parse()
+	}
+
+	if *preset != "" {
+		if err := applyPreset(flag.CommandLine, *preset); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *preserveOrder {
+		orderSet := false
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "order" {
+				orderSet = true
+			}
+		})
+		if !orderSet {
+			*order = ""
+		}
+	}
+
+	if *passthroughStderr {
+		*passthrough = true
+	}
+	if *passthrough {
+		if *textAs != "" || *errorField {
+			log.Fatalf("-passthrough can't be combined with -text-as or -error-field")
+		}
+		*skipErrors = true
+	}
+
+	if *reverse {
+		formatSet := false
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "format" || f.Name == "canonicalize" {
+				formatSet = true
+			}
+		})
+		if !formatSet {
+			*format = "json"
+		}
+	}
+
+	args := flag.Args()
+	if len(args) < 1 && *inputGlob == "" && !*dryRun {
+		log.Fatalf("usage: %s <file|->...", os.Args[0])
+	}
+	inputs := args
+	if *inputGlob != "" {
+		matches, err := filepath.Glob(*inputGlob)
+		if err != nil {
+			log.Fatalf("invalid -glob: %s", err)
+		}
+		if len(matches) == 0 && !*dryRun {
+			log.Fatalf("-glob %s matches no files", *inputGlob)
+		}
+		sort.Strings(matches)
+		inputs = append(inputs, matches...)
+	}
+
+	if *mergeByTime && *follow {
+		log.Fatalf("-merge-by-time can't be combined with -follow")
+	}
+	if *follow {
+		if len(inputs) != 1 || inputs[0] == "-" || strings.HasSuffix(inputs[0], ".gz") || strings.HasSuffix(inputs[0], ".zst") {
+			log.Fatalf("-follow needs a single uncompressed file")
+		}
+		if *tailN > 0 || *check || *checkAll {
+			log.Fatalf("-follow can't be combined with -tail, -check or -check-all")
+		}
+	}
+
+	if *parallel < 0 {
+		log.Fatalf("-parallel must not be negative")
+	}
+	if *parallel > 1 {
+		explicit := false
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "concurrency" {
+				explicit = true
+			}
+		})
+		if !explicit {
+			*concurrency = *parallel
+		}
+	}
+
+	c := converterFromFlags()
+	if strings.Contains(*keyPrefix, "{file}") {
+		c.keyPrefixes = make([]string, len(inputs))
+		for i, path := range inputs {
+			c.keyPrefixes[i] = strings.ReplaceAll(*keyPrefix, "{file}", inputDisplayName(path))
+		}
+	}
+
+	if *outputBufferSize < 1 {
+		log.Fatalf("-output-buffer-size must be positive")
+	}
+	var stdout io.Writer = os.Stdout
+	if *bench {
+		stdout = io.Discard
+	}
+	out := newOutput(stdout, *outputBufferSize)
+	if *jsonArr && c.format == "json" {
+		out.array = &jsonArray{}
+	}
+	wrapWidth, err := parseWrap(*wrap)
+	if err != nil {
+		log.Fatalf("invalid -wrap %q: %s", *wrap, err)
+	}
+	out.wrap = wrapWidth
+	if *failOnEmpty && *failOnNonempty {
+		log.Fatalf("-fail-on-empty and -fail-on-nonempty are mutually exclusive")
+	}
+	if *padKeys && !*expand {
+		log.Fatalf("-pad-keys needs -expand")
+	}
+	if *expand {
+		if *align || out.wrap > 0 {
+			log.Fatalf("-expand can't be combined with -align or -wrap")
+		}
+		out.expand = true
+		out.padKeys = *padKeys
+	}
+	if *limitBytes < 0 {
+		log.Fatalf("-limit-bytes must not be negative")
+	}
+	out.limit = *limitBytes
+	if *align {
+		if *alignWindow < 0 {
+			log.Fatalf("-align-window must not be negative")
+		}
+		if *alignWindow == 0 && *follow {
+			log.Fatalf("-align-window 0 can't be combined with -follow")
+		}
+		out.align = &aligner{window: *alignWindow}
+		out.flushAlign = *follow
+	}
+
+	w := &recordWriter{
+		out:   out,
+		stats: &runStats{},
+		opts:  c.opts,
+	}
+	if c.context {
+		w.context = &contextFilter{before: *contextBefore, after: *contextAfter, stats: w.stats}
+	}
+	if *headN < 0 || *tailN < 0 {
+		log.Fatalf("-head and -tail must not be negative")
+	}
+	if *headN > 0 && *tailN > 0 {
+		log.Fatalf("-head and -tail can't be combined")
+	}
+	if *headN > 0 {
+		w.head = *headN
+	}
+	if *headN > 0 || *limitBytes > 0 {
+		w.stop = make(chan struct{})
+	}
+	if *tailN > 0 {
+		w.tail = newTailBuffer(*tailN)
+	}
+	if *blankBetween || *blankBetweenFiles {
+		if out.array != nil {
+			log.Fatalf("-blank-between can't be combined with -json-array")
+		}
+		w.blankBetween = *blankBetween
+		w.blankBetweenFiles = *blankBetweenFiles
+	}
+	if *emitMeta {
+		if out.array != nil {
+			log.Fatalf("-emit-meta can't be combined with -json-array")
+		}
+		files := make([]string, len(inputs))
+		for i, path := range inputs {
+			files[i] = inputDisplayName(path)
+		}
+		w.meta = &metaFormat{format: *metaFormatFlag, files: files}
+	}
+	if *uniqBy != "" {
+		switch *uniqKeep {
+		case "first", "last":
+		default:
+			log.Fatalf("unknown -uniq-keep %q (expected first or last)", *uniqKeep)
+		}
+		w.uniq = newUniqFilter(strings.Split(*uniqBy, ","), *uniqKeep == "last")
+		c.uniq = w.uniq
+	}
+	if *groupBy != "" {
+		w.groupBy = *groupBy
+		c.groupBy = *groupBy
+	}
+	if *sampleRate < 1 {
+		if *sampleRate < 0 {
+			log.Fatalf("-sample must be between 0 and 1")
+		}
+		seed := *sampleSeed
+		if seed == 0 {
+			seed = c.now().UnixNano()
+		}
+		w.sampleRate = *sampleRate
+		w.sampler = rand.New(rand.NewSource(seed))
+	}
+
+	switch *inputFraming {
+	case "none", "newline", "rs":
+	default:
+		log.Fatalf("unknown -input-framing %q (expected none, newline or rs)", *inputFraming)
+	}
+	recordOpts := convert.RecordOptions{
+		SkipErrors: *skipErrors,
+		TextAs:     *textAs,
+		Framing:    *inputFraming,
+		Docker:     *docker,
+		QuoteChar:  c.opts.QuoteChar,
+
+		PreserveOrder: *preserveOrder,
+	}
+	if *preserveOrder && (*docker || *reverse || *rootPointer != "") {
+		log.Fatalf("-preserve-order can't be combined with -docker, -reverse or -root")
+	}
+	if *docker && (*reverse || *rootPointer != "") {
+		log.Fatalf("-docker can't be combined with -reverse or -root")
+	}
+	if *reverse {
+		if *rootPointer != "" || *inputFraming != "none" {
+			log.Fatalf("-reverse reads one logfmt record per line and can't be combined with -root or -input-framing")
+		}
+		recordOpts.Logfmt = true
+	}
+	if *parallel > 1 {
+		switch {
+		case *rootPointer != "":
+			log.Fatalf("-parallel decodes one record per line and can't be combined with -root")
+		case *inputFraming == "rs":
+			log.Fatalf("-parallel decodes one record per line and can't be combined with -input-framing=rs")
+		case *follow:
+			// a batch isn't decoded until it is full
+			log.Fatalf("-parallel can't be combined with -follow")
+		case !*reverse:
+			recordOpts.Framing = "newline"
+		}
+		recordOpts.Workers = *parallel
+	}
+	if *rootPointer != "" {
+		if *skipErrors || *textAs != "" || *checkAll || *inputFraming == "newline" {
+			log.Fatalf("-root can't be combined with line at a time decoding (-skip-errors, -text-as, -check-all or -input-framing=newline)")
+		}
+		path, err := convert.ParseJSONPointer(*rootPointer)
+		if err != nil {
+			log.Fatalf("invalid -root: %s", err)
+		}
+		recordOpts.Root = path
+	}
+
+	if *dryRun {
+		describeConfig(os.Stderr, c, w)
+		return
+	}
+
+	if *syslogOut {
+		sink, err := dialSyslog(*syslogAddr, *syslogTag)
+		if err != nil {
+			log.Fatalf("syslog err: %s", err)
+		}
+		defer sink.close()
+		w.syslog = sink
+	}
+
+	if *check || *checkAll {
+		errors := 0
+		for _, path := range inputs {
+			in, err := openInput(path)
+			if err != nil {
+				log.Fatalf("open %s err: %s", path, err)
+			}
+			errors += runCheck(in, recordOpts, *checkAll)
+			in.Close()
+		}
+		if errors > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	var br *benchRun
+	if *bench {
+		br = startBench()
+	}
+	var records convert.RecordReader
+	if *mergeByTime {
+		m := newMergeReader(inputs, recordOpts, *keepGoing, splitList(*timeField))
+		if br != nil {
+			for _, in := range m.inputs {
+				in.wrap = br.wrap
+			}
+		}
+		defer m.close()
+		records = m
+	} else {
+		m := &multiReader{paths: inputs, opts: recordOpts, keepGoing: *keepGoing, follow: *follow}
+		if br != nil {
+			m.wrap = br.wrap
+		}
+		defer m.close()
+		records = m
+	}
+
+	if statsMode {
+		if *follow {
+			log.Fatalf("stats can't be combined with -follow")
+		}
+		runStatsCommand(records, c, out, w.stats)
+		out.close()
+		w.stats.report()
+		if out.reachedLimit() {
+			os.Exit(exitLimit)
+		}
+		return
+	}
+
+	out.flushOnSignal()
+	go out.flushPeriodically()
+
+	if *concurrency > 1 {
+		runConcurrent(records, c, *concurrency, w)
+	} else {
+		runSerial(records, c, w)
+	}
+	if it, ok := c.flushWindow(w.stats.records); ok {
+		w.write(it)
+	}
+	w.finish()
+	c.close()
+	out.close()
+	w.stats.report()
+	if br != nil {
+		br.report(w.stats)
+	}
+
+	if out.reachedLimit() {
+		os.Exit(exitLimit)
+	}
+	if *warnEmpty && w.stats.records == 0 {
+		warnf("no records in input")
+		os.Exit(exitEmpty)
+	}
+	if *failOnEmpty && w.stats.written == 0 {
+		warnf("no records matched")
+		os.Exit(exitAssert)
+	}
+	if *failOnNonempty && w.stats.written > 0 {
+		warnf("%d records matched", w.stats.written)
+		os.Exit(exitAssert)
+	}
+}
+
+// hiddenFlags are left out of the -help output.
+var hiddenFlags = map[string]bool{
+	"bench": true,
+}
+
+func usage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintf(w, "usage: %s [flags] <file|->...\n", os.Args[0])
+	fmt.Fprintf(w, "       %s stats [-by fields] [-top n] [flags] <file|->...\n", os.Args[0])
+	flag.VisitAll(func(f *flag.Flag) {
+		if hiddenFlags[f.Name] {
+			return
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "  -%s", f.Name)
+		name, usage := flag.UnquoteUsage(f)
+		if name != "" {
+			b.WriteString(" " + name)
+		}
+		b.WriteString("\n    \t" + usage)
+		switch {
+		case f.DefValue == "" || f.DefValue == "false" || f.DefValue == "0":
+		case name == "string":
+			fmt.Fprintf(&b, " (default %q)", f.DefValue)
+		default:
+			fmt.Fprintf(&b, " (default %s)", f.DefValue)
+		}
+		fmt.Fprintln(w, b.String())
+	})
+	fmt.Fprint(w, `
+exit status:
+  0  success
+  1  fatal error
+  2  invalid command line flags
+  3  -warn-empty found no input records
+  4  output stopped at -limit-bytes
+  5  a -fail-on-empty or -fail-on-nonempty check failed
+`)
+}
+
+// converterFromFlags builds the record converter configured by the
+// command line flags.
+func converterFromFlags() *converter {
+	if *maxKeyLen != 0 && *maxKeyLen <= len(keyHashSep)+keyHashLen {
+		log.Fatalf("-max-key-len must be more than %d", len(keyHashSep)+keyHashLen)
+	}
+	if *maxFields < 0 {
+		log.Fatalf("-max-fields must not be negative")
+	}
+	if *canonicalize {
+		*format = "canonical"
+	}
+	if *pretty {
+		*format = "pretty"
+	}
+	var tmpl *recordTemplate
+	if *templateFlag != "" {
+		var err error
+		if tmpl, err = parseRecordTemplate(*templateFlag); err != nil {
+			log.Fatal(err)
+		}
+		*format = "template"
+	}
+	switch *format {
+	case "logfmt", "json", "pretty", "pretty-json", "canonical":
+	case "template":
+		if tmpl == nil {
+			log.Fatalf("-format template needs -template")
+		}
+	default:
+		log.Fatalf("unknown -format %q", *format)
+	}
+
+	if len(*quoteCharFlag) != 1 || strings.ContainsAny(*quoteCharFlag, " =\\") || (*quoteCharFlag)[0] < '!' || (*quoteCharFlag)[0] > '~' {
+		log.Fatalf("-quote-char must be a single printable ASCII character other than space, = or \\")
+	}
+	if *floatPrecision < -1 {
+		log.Fatalf("-float-precision must be -1 or more")
+	}
+	jsonEscapeHTML = !*noHTMLEscape
+
+	var invalidUTF8 convert.InvalidUTF8
+	switch *invalidUTF8Flag {
+	case "replace":
+		invalidUTF8 = convert.UTF8Replace
+	case "escape":
+		invalidUTF8 = convert.UTF8Escape
+	case "strip":
+		invalidUTF8 = convert.UTF8Strip
+	default:
+		log.Fatalf("unknown -invalid-utf8 %q (expected replace, escape or strip)", *invalidUTF8Flag)
+	}
+	numberPrecision := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "float-precision" {
+			numberPrecision = true
+		}
+	})
+	opts := convert.Options{
+		QuoteChar:       (*quoteCharFlag)[0],
+		FloatFormat:     'f',
+		FloatPrecision:  *floatPrecision,
+		NumberPrecision: numberPrecision,
+		InvalidUTF8:     invalidUTF8,
+		Now:             time.Now,
+	}
+
+	switch *arrayMode {
+	case "value", "count", "counts":
+	default:
+		log.Fatalf("unknown -array-mode %q (expected value, count or counts)", *arrayMode)
+	}
+
+	fieldOrder := newFieldOrder(strings.Split(*order, ","), splitList(*orderLast))
+	switch *numericKeys {
+	case "string", "array":
+	default:
+		log.Fatalf("unknown -numeric-keys %q (expected string or array)", *numericKeys)
+	}
+
+	switch *orderTiebreak {
+	case "lexical":
+	case "natural":
+		fieldOrder.Natural = true
+	default:
+		log.Fatalf("unknown -order-tiebreak %q (expected lexical or natural)", *orderTiebreak)
+	}
+
+	var lineMatch, lineExclude *regexp.Regexp
+	if *lineGrep != "" {
+		var err error
+		lineMatch, err = regexp.Compile(*lineGrep)
+		if err != nil {
+			log.Fatalf("invalid -line-grep regex: %s", err)
+		}
+	}
+	if *lineGrepV != "" {
+		var err error
+		lineExclude, err = regexp.Compile(*lineGrepV)
+		if err != nil {
+			log.Fatalf("invalid -line-grep-v regex: %s", err)
+		}
+	}
+
+	if *contextAfter < 0 || *contextBefore < 0 || *contextBoth < 0 {
+		log.Fatalf("-A, -B and -C must not be negative")
+	}
+	if *contextBoth > 0 {
+		flagsSet := make(map[string]bool)
+		flag.Visit(func(f *flag.Flag) {
+			flagsSet[f.Name] = true
+		})
+		if !flagsSet["A"] {
+			*contextAfter = *contextBoth
+		}
+		if !flagsSet["B"] {
+			*contextBefore = *contextBoth
+		}
+	}
+	context := *contextAfter > 0 || *contextBefore > 0
+
+	var greps []*recordGrep
+	if *grepExpr != "" {
+		g, err := newRecordGrep(*grepExpr, *grepField, false)
+		if err != nil {
+			log.Fatalf("invalid -grep regex: %s", err)
+		}
+		greps = append(greps, g)
+	}
+	if *grepV != "" {
+		g, err := newRecordGrep(*grepV, *grepField, true)
+		if err != nil {
+			log.Fatalf("invalid -grep-v regex: %s", err)
+		}
+		greps = append(greps, g)
+	}
+	if *grepField != "" && greps == nil {
+		log.Fatalf("-grep-field needs -grep or -grep-v")
+	}
+
+	var setFields []constField
+	for _, spec := range sets {
+		idx := strings.Index(spec, "=")
+		if idx < 1 {
+			log.Fatalf("invalid -set %q, expected key=value", spec)
+		}
+		setFields = append(setFields, constField{key: spec[:idx], value: spec[idx+1:]})
+	}
+
+	var fieldRenames []fieldRename
+	for _, spec := range renames {
+		r, err := parseRename(spec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fieldRenames = append(fieldRenames, r)
+	}
+	if *normalize {
+		fieldRenames = append(fieldRenames, normalizeRenames...)
+	}
+
+	var foldFields []*foldField
+	for _, spec := range folds {
+		f, err := parseFold(spec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		foldFields = append(foldFields, f)
+	}
+
+	var replacers []*valueReplacer
+	for _, spec := range replaces {
+		r, err := parseReplace(spec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		replacers = append(replacers, r)
+	}
+
+	var filterExprs []filterExpr
+	for _, expr := range filters {
+		e, err := parseFilter(expr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		filterExprs = append(filterExprs, e)
+	}
+
+	var lookupTables []*lookupTable
+	for _, spec := range lookups {
+		l, err := parseLookup(spec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		lookupTables = append(lookupTables, l)
+	}
+	var lookupDefault *string
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "lookup-default" {
+			lookupDefault = lookupDef
+		}
+	})
+
+	var levels *levelDetector
+	var minSeverity severity
+	if *minLevel != "" {
+		var err error
+		minSeverity, err = parseSeverity(*minLevel)
+		if err != nil {
+			log.Fatalf("invalid -min-level: %s", err)
+		}
+		levels, err = newLevelDetector(strings.Split(*levelField, ","), *levelNumbers, *levelsMapping)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var severities *levelDetector
+	if *syslogAddr != "" {
+		*syslogOut = true
+	}
+	color, err := parseColorMode(*colorMode)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// syslog lines aren't shown on a terminal, and -bench discards its
+	// output whatever stdout is
+	color = color && !*syslogOut && !(*bench && *colorMode == "auto")
+	if *syslogOut || color {
+		severities, err = newLevelDetector(strings.Split(*levelField, ","), *levelNumbers, *levelsMapping)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	timeLayouts = append(append([]string(nil), timeInputFormats...), timeLayouts...)
+	if *timeRelative && *timeSince != "" {
+		log.Fatalf("-time-relative and -time-since are mutually exclusive")
+	}
+	relative := *timeRelative || *timeSince != ""
+	var loc *time.Location
+	if *timeZone != "" {
+		var err error
+		if loc, err = time.LoadLocation(*timeZone); err != nil {
+			log.Fatalf("invalid -time-zone: %s", err)
+		}
+		if *timeLayout == "" && !relative {
+			*timeLayout = time.RFC3339
+		}
+	}
+
+	now := opts.CurrentTime
+	var times *timeFormatter
+	if relative {
+		if *timeLayout != "" || loc != nil {
+			log.Fatalf("-time-relative and -time-since can't be combined with -time-format or -time-zone")
+		}
+		if *concurrency > 1 {
+			log.Fatalf("-time-relative and -time-since need records in input order and can't be used with -concurrency or -parallel")
+		}
+		times = &timeFormatter{fields: splitList(*timeField), relative: true}
+		switch *timeSince {
+		case "":
+		case "prev":
+			times.humanize, times.sincePrev = true, true
+		case "first":
+			times.humanize = true
+		default:
+			clock := now()
+			anchor, err := parseTimeBound(*timeSince, clock, clock)
+			if err != nil {
+				log.Fatalf("invalid -time-since %q (expected prev, first, or a time as for -since)", *timeSince)
+			}
+			times.humanize = true
+			times.base, times.haveBase = anchor, true
+		}
+	} else if *timeLayout != "" {
+		times = &timeFormatter{fields: splitList(*timeField), layout: *timeLayout, loc: loc}
+	}
+
+	timeBounds, err := newTimeRange(splitList(*timeField), *sinceFlag, *untilFlag, now, loc)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var delta *deltaFilter
+	if *deltaFlag {
+		if *concurrency > 1 {
+			log.Fatalf("-delta needs records in input order and can't be used with -concurrency or -parallel")
+		}
+		delta = &deltaFilter{keep: make(map[string]bool), showRemoved: *deltaShowRemoved, opts: opts}
+		for k := range fieldOrder.Head {
+			delta.keep[k] = true
+		}
+		for _, k := range splitList(*timeField) {
+			delta.keep[k] = true
+		}
+	}
+
+	var window *windowAgg
+	if *windowSize != 0 {
+		if *windowSize < 0 {
+			log.Fatalf("-window must be positive")
+		}
+		if *concurrency > 1 {
+			log.Fatalf("-window needs records in input order and can't be used with -concurrency or -parallel")
+		}
+		if context {
+			log.Fatalf("-window can't be combined with -A, -B or -C")
+		}
+		if relative {
+			log.Fatalf("-window can't be combined with -time-relative or -time-since")
+		}
+		aggs, err := parseAggs(*aggSpecs)
+		if err != nil {
+			log.Fatal(err)
+		}
+		layout := time.RFC3339
+		if *timeLayout != "" {
+			layout = *timeLayout
+		}
+		window = &windowAgg{size: *windowSize, timeFields: splitList(*timeField), layout: layout, loc: loc, aggs: aggs}
+	}
+
+	var human *humanizer
+	if *humanize || *durationFields != "" || *bytesFields != "" {
+		durations, err := parseDurationFields(*durationFields)
+		if err != nil {
+			log.Fatal(err)
+		}
+		human = &humanizer{heuristic: *humanize, durations: durations, bytes: fieldSet(*bytesFields)}
+	}
+
+	collide, err := parseCollisionPolicy(*onCollision)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var flat *flattener
+	if *flattenArrays {
+		*flatten = true
+	}
+	if *flattenMaxDepth < 0 {
+		log.Fatalf("-flatten-max-depth must not be negative")
+	}
+	if *flatten || *rawJSON != "" {
+		flat = &flattener{
+			enabled:  *flatten,
+			arrays:   *flattenArrays,
+			maxDepth: *flattenMaxDepth,
+			prefix:   *flattenPrefix,
+			rawJSON:  fieldSet(*rawJSON),
+		}
+	}
+
+	var jsonIndent string
+	if *jsonArr {
+		jsonIndent = "  "
+	}
+
+	var digitSep string
+	if *groupDigitsFlag {
+		digitSep = *digitSeparator
+	}
+
+	selector, err := newFieldSelector(*onlyFields, *excludeFields)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	redact, err := newRedactor(*redactFields, *redactMode)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var execer *execTransformer
+	if *execCommand != "" {
+		execer = &execTransformer{command: *execCommand}
+	}
+
+	return &converter{
+		opts:               opts,
+		now:                now,
+		exec:               execer,
+		jsonFields:         splitList(*parseJSONFields),
+		numericKeysAsArray: *numericKeys == "array",
+		flattener:          flat,
+		collide:            collide,
+		renames:            fieldRenames,
+		levels:             levels,
+		severities:         severities,
+		minSeverity:        minSeverity,
+		timeRange:          timeBounds,
+		sets:               setFields,
+		folds:              foldFields,
+		lookups:            lookupTables,
+		lookupDef:          lookupDefault,
+		arrayMode:          *arrayMode,
+		collapseWS:         *collapseWS,
+		replacers:          replacers,
+		replaceIn:          fieldSet(*replaceField),
+		times:              times,
+		fieldOrder:         fieldOrder,
+		keyLess:            fieldOrder.Less,
+		format:             *format,
+		template:           tmpl,
+		prettyHeader:       [][]string{splitList(*timeField), splitList(*levelField), {"msg", "message"}},
+		maxFields:          *maxFields,
+		delta:              delta,
+		humanize:           human,
+		window:             window,
+		dropEmptyRecords:   *dropEmptyRecords,
+		maxKeyLen:          *maxKeyLen,
+		color:              color,
+		jsonIndent:         jsonIndent,
+		asString:           fieldSet(*asString),
+		asNumber:           fieldSet(*asNumber),
+		numbersAsString:    *numbersAsString,
+		digitSep:           digitSep,
+		requireAll:         splitList(*requireAll),
+		requireAny:         splitList(*requireAny),
+		filters:            filterExprs,
+		selector:           selector,
+		redact:             redact,
+		keyPrefix:          *keyPrefix,
+		hashField:          *hashField,
+		lineMatch:          lineMatch,
+		lineExclude:        lineExclude,
+		greps:              greps,
+		context:            context,
+	}
+}
+
+// splitList splits a comma separated flag value, returning nil for an
+// empty value.
+func splitList(list string) []string {
+	if list == "" {
+		return nil
+	}
+	return strings.Split(list, ",")
+}
+
+// fieldSet splits a comma separated flag value into a set of field
+// names.
+func fieldSet(list string) map[string]bool {
+	set := make(map[string]bool)
+	if list == "" {
+		return set
+	}
+	for _, f := range strings.Split(list, ",") {
+		set[f] = true
+	}
+	return set
+}
+
+// field is a rendered logfmt key/value pair. value is already escaped.
+type field struct {
+	key   string
+	value string
+
+	// bare fields are markers written as just their key, with no
+	// value.
+	bare bool
+
+	// keyColor and valueColor are ANSI colors for -color. They don't
+	// count towards the width.
+	keyColor   string
+	valueColor string
+
+	// keyMatches and valueMatches are the byte ranges -grep
+	// highlights.
+	keyMatches   [][]int
+	valueMatches [][]int
+}
+
+// pair renders f as it appears in a logfmt line.
+func (f field) pair() string {
+	if f.bare {
+		return paintMatches(f.keyColor, f.key, f.keyMatches)
+	}
+	return paintMatches(f.keyColor, f.key, f.keyMatches) + "=" + paintMatches(f.valueColor, f.value, f.valueMatches)
+}
+
+// colored reports whether pair adds any ANSI escapes.
+func (f field) colored() bool {
+	return f.keyColor != "" || f.valueColor != "" || f.keyMatches != nil || f.valueMatches != nil
+}
+
+// writePair writes f.pair() to b without building it first.
+func (f field) writePair(b *strings.Builder) {
+	if f.colored() {
+		b.WriteString(f.pair())
+		return
+	}
+	b.WriteString(f.key)
+	if !f.bare {
+		b.WriteByte('=')
+		b.WriteString(f.value)
+	}
+}
+
+// width is the display width of f.pair().
+func (f field) width() int {
+	if f.bare {
+		return displayWidth(f.key)
+	}
+	return displayWidth(f.key) + 1 + displayWidth(f.value)
+}
+
+// keyHashSep and keyHashLen make up the suffix shortenKey adds to a
+// truncated key.
+const (
+	keyHashSep = "~"
+	keyHashLen = 6
+)
+
+// shortenKey truncates key to at most max runes if it is longer,
+// replacing the end with a hash of the whole key. The same key always
+// shortens to the same result, and keys sharing a long prefix still get
+// distinct results. max of 0 leaves key as is.
+func shortenKey(key string, max int) string {
+	if max <= 0 || utf8.RuneCountInString(key) <= max {
+		return key
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	suffix := keyHashSep + fmt.Sprintf("%08x", h.Sum32())[:keyHashLen]
+
+	keep := max - len(suffix)
+	cut := 0
+	for i := 0; i < keep; i++ {
+		_, size := utf8.DecodeRuneInString(key[cut:])
+		cut += size
+	}
+	return key[:cut] + suffix
+}
+
+func joinFields(fields []field) string {
+	// size the line up front so it is built with a single allocation
+	n := len(fields)
+	for _, f := range fields {
+		n += len(f.key) + len(f.value) + len(f.keyColor) + len(f.valueColor)
+		if f.colored() {
+			n += 2 * len(ansiReset)
+		}
+	}
+	var b strings.Builder
+	b.Grow(n)
+	for i, f := range fields {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		f.writePair(&b)
+	}
+	return b.String()
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/psanford/logfmt/convert"
+)
+
+// lookupTable enriches records by mapping a field's value through a
+// two column tab separated file loaded at startup.
+type lookupTable struct {
+	field  string
+	outKey string
+	table  map[string]string
+}
+
+// parseLookup parses a -lookup spec of the form field:file[:outkey].
+// outkey defaults to field_text.
+func parseLookup(spec string) (*lookupTable, error) {
+	parts := strings.SplitN(spec, ":", 3)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("invalid -lookup %q, expected field:file[:outkey]", spec)
+	}
+	l := &lookupTable{
+		field:  parts[0],
+		outKey: parts[0] + "_text",
+		table:  make(map[string]string),
+	}
+	if len(parts) == 3 && parts[2] != "" {
+		l.outKey = parts[2]
+	}
+
+	f, err := os.Open(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("-lookup: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		idx := strings.IndexByte(line, '\t')
+		if idx < 0 {
+			return nil, fmt.Errorf("-lookup %s:%d: expected two tab separated columns", parts[1], lineNum)
+		}
+		l.table[line[:idx]] = line[idx+1:]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("-lookup %s: %w", parts[1], err)
+	}
+
+	return l, nil
+}
+
+// apply adds the looked up value for rec, or def if the value isn't in
+// the table and def is set.
+func (l *lookupTable) apply(rec map[string]interface{}, def *string, collide *collider) error {
+	v, ok := rec[l.field]
+	if !ok || v == nil {
+		return nil
+	}
+	text, found := l.table[convert.PlainValue(v)]
+	if !found {
+		if def == nil {
+			return nil
+		}
+		text = *def
+	}
+	return collide.set(rec, l.outKey, text)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// metaFormat renders the -emit-meta prefix written before each record,
+// outside of its key=value pairs. The format may refer to {file}, the
+// input file name, {line}, the input line the record started on, and
+// {seq}, the 1-based position of the record in the input.
+type metaFormat struct {
+	format string
+	// files holds the display names of the inputs, indexed by
+	// item.file.
+	files []string
+}
+
+func (m *metaFormat) render(it item) string {
+	var file string
+	if it.file < len(m.files) {
+		file = m.files[it.file]
+	}
+	return strings.NewReplacer(
+		"{file}", file,
+		"{line}", strconv.Itoa(it.srcLine),
+		"{seq}", strconv.Itoa(it.seq+1),
+	).Replace(m.format)
+}
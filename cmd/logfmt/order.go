@@ -0,0 +1,109 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/psanford/logfmt/convert"
+)
+
+// orderRest is the -order entry standing for every field not otherwise
+// listed. Fields after it are pinned to the end of the line.
+const orderRest = "..."
+
+// fieldOrder sorts record keys so that the fields named in -order come
+// first (in that order) and everything else follows bytewise, or in
+// natural order with -order-tiebreak natural. Fields listed after a
+// "..." entry are instead placed last, in the order given, followed by
+// the -order-last fields. The comparison itself is convert.KeyOrder's,
+// so the library's default order is the command's.
+type fieldOrder struct {
+	convert.KeyOrder
+}
+
+// newFieldOrder builds the ordering for -order fields and -order-last
+// last. A field named by both is placed last: -order-last is the more
+// specific request.
+func newFieldOrder(fields, last []string) *fieldOrder {
+	o := &fieldOrder{convert.KeyOrder{
+		Head: make(map[string]int),
+		Tail: make(map[string]int),
+	}}
+	index := o.Head
+	for _, f := range fields {
+		if f == orderRest {
+			index = o.Tail
+			continue
+		}
+		if _, ok := index[f]; !ok {
+			index[f] = len(index)
+		}
+	}
+
+	for _, f := range last {
+		delete(o.Head, f)
+		delete(o.Tail, f)
+	}
+	// positions only need to be increasing, so gaps left by deleted
+	// entries are harmless
+	next := 0
+	for _, i := range o.Tail {
+		if i >= next {
+			next = i + 1
+		}
+	}
+	for _, f := range last {
+		if _, ok := o.Tail[f]; !ok && f != "" {
+			o.Tail[f] = next
+			next++
+		}
+	}
+	return o
+}
+
+// inputLess is Less for a record whose top level keys appeared in the
+// input in the order keys, for -preserve-order: fields not placed by
+// -order keep the input order, a flattened key taking the position of
+// its top level key. Keys the transforms added come after the input
+// ones. Ties fall back to Less.
+func (o *fieldOrder) inputLess(keys []string) func(a, b string) bool {
+	pos := make(map[string]int, len(keys))
+	for i, k := range keys {
+		pos[k] = i
+	}
+	position := func(k string) int {
+		if i, ok := pos[k]; ok {
+			return i
+		}
+		if dot := strings.IndexByte(k, '.'); dot > 0 {
+			if i, ok := pos[k[:dot]]; ok {
+				return i
+			}
+		}
+		return len(keys)
+	}
+	return func(a, b string) bool {
+		sectionA, _ := o.Rank(a)
+		sectionB, _ := o.Rank(b)
+		if sectionA == 1 && sectionB == 1 {
+			if pa, pb := position(a), position(b); pa != pb {
+				return pa < pb
+			}
+		}
+		return o.Less(a, b)
+	}
+}
+
+// sortKeys returns the keys of rec ordered by less.
+func sortKeys(rec map[string]interface{}, less func(a, b string) bool) []string {
+	sortedFields := make([]string, 0, len(rec))
+	for k := range rec {
+		sortedFields = append(sortedFields, k)
+	}
+
+	sort.Slice(sortedFields, func(i, j int) bool {
+		return less(sortedFields[i], sortedFields[j])
+	})
+
+	return sortedFields
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// flushInterval bounds how long buffered output may sit unwritten, so
+// slow streams (pipes, -follow) aren't starved by a large buffer.
+const flushInterval = 100 * time.Millisecond
+
+// output is a buffered, goroutine safe line writer.
+type output struct {
+	mu    sync.Mutex
+	w     *bufio.Writer
+	align *aligner
+	array *jsonArray
+
+	// flushAlign writes the records held by the aligner once no record
+	// has arrived for a flushInterval, so that with -follow a quiet
+	// stream isn't held back waiting for a full -align-window. added
+	// notes a record arrived since the last periodic flush.
+	flushAlign bool
+	added      bool
+
+	// wrap, if positive, breaks logfmt lines longer than this many
+	// columns between fields.
+	wrap int
+
+	// expand writes each field of a logfmt record on its own line,
+	// with an empty line between records. padKeys pads keys to the
+	// widest in the record so that the = signs line up.
+	expand       bool
+	padKeys      bool
+	expandedOnce bool
+
+	// limit, if positive, caps the bytes written. The first line that
+	// would go past it and every line after it are dropped, and
+	// limited is set so that the pipeline stops reading. A -json-array
+	// keeps room to be closed.
+	limit   int64
+	written int64
+	limited bool
+}
+
+func newOutput(w io.Writer, size int) *output {
+	return &output{w: bufio.NewWriterSize(w, size)}
+}
+
+// writeRecord writes a rendered record, passing it through the aligner
+// when -align is active. meta, if set, is written before the record.
+func (o *output) writeRecord(meta, line string, fields []field) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	switch {
+	case o.align != nil:
+		o.added = true
+		for _, l := range o.align.add(meta, line, fields) {
+			o.writeLocked(l)
+		}
+	case o.array != nil:
+		if o.limit > 0 && !o.limited && !o.arrayFits(line) {
+			o.limited = true
+			infof("stopped at the -limit-bytes cap after %d bytes", o.written)
+		}
+		if o.limited {
+			return
+		}
+		for _, l := range o.array.add(line) {
+			o.writeLocked(l)
+		}
+	case o.expand && fields != nil:
+		if o.expandedOnce {
+			o.writeLocked("")
+		}
+		o.expandedOnce = true
+		if meta != "" {
+			o.writeLocked(meta)
+		}
+		for _, l := range expandFields(fields, o.padKeys) {
+			o.writeLocked(l)
+		}
+	case o.wrap > 0 && fields != nil:
+		for i, l := range wrapFields(fields, o.wrap) {
+			if i == 0 && meta != "" {
+				l = meta + " " + l
+			}
+			o.writeLocked(l)
+		}
+	case meta != "":
+		o.writeLocked(meta + " " + line)
+	default:
+		o.writeLocked(line)
+	}
+}
+
+// arrayFits reports whether adding line to the -json-array leaves
+// room under limit for the lines it holds back and the closing ].
+func (o *output) arrayFits(line string) bool {
+	n := o.written + int64(len(line)) + 1 + int64(len("]\n"))
+	if o.array.pending == nil {
+		n += int64(len("[\n"))
+	} else {
+		n += int64(len(*o.array.pending)) + int64(len(",\n"))
+	}
+	return n <= o.limit
+}
+
+func (o *output) writeLine(line string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.writeLocked(line)
+}
+
+func (o *output) writeLocked(line string) {
+	if o.limit > 0 {
+		if o.limited {
+			return
+		}
+		if o.written+int64(len(line))+1 > o.limit {
+			o.limited = true
+			infof("stopped at the -limit-bytes cap after %d bytes", o.written)
+			return
+		}
+		o.written += int64(len(line)) + 1
+	}
+	o.writeUncapped(line)
+}
+
+// writeUncapped writes line regardless of limit.
+func (o *output) writeUncapped(line string) {
+	o.w.WriteString(line)
+	if err := o.w.WriteByte('\n'); err != nil {
+		log.Fatalf("write err: %s", err)
+	}
+}
+
+func (o *output) flush() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.flushLocked()
+}
+
+func (o *output) flushLocked() {
+	if err := o.w.Flush(); err != nil {
+		log.Fatalf("write err: %s", err)
+	}
+}
+
+// close writes any records held back by the aligner, closes a
+// -json-array and flushes the output.
+func (o *output) close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.align != nil {
+		for _, l := range o.align.flush() {
+			o.writeLocked(l)
+		}
+	}
+	if o.array != nil {
+		// an empty array is written even past a cap too small
+		// for it, rather than leaving the output unterminated
+		for _, l := range o.array.finish() {
+			if o.limited {
+				o.writeUncapped(l)
+			} else {
+				o.writeLocked(l)
+			}
+		}
+	}
+	o.flushLocked()
+}
+
+// reachedLimit reports whether output stopped at the limit.
+func (o *output) reachedLimit() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.limited
+}
+
+// fatal flushes any buffered output before exiting with err.
+func (o *output) fatal(err error) {
+	o.close()
+	log.Fatal(err)
+}
+
+// flushPeriodically flushes the output every flushInterval.
+func (o *output) flushPeriodically() {
+	for range time.Tick(flushInterval) {
+		o.tick()
+	}
+}
+
+// tick is a periodic flush, first writing the aligner's records under
+// flushAlign if none arrived since the previous tick.
+func (o *output) tick() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.flushAlign && !o.added {
+		for _, l := range o.align.flush() {
+			o.writeLocked(l)
+		}
+	}
+	o.added = false
+	o.flushLocked()
+}
+
+// flushOnSignal flushes the output and exits when interrupted.
+func (o *output) flushOnSignal() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		o.close()
+		os.Exit(130)
+	}()
+}
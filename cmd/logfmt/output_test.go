@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestOutputFlushAlignWhenIdle(t *testing.T) {
+	var buf bytes.Buffer
+	o := newOutput(&buf, 4096)
+	o.align = &aligner{window: 100}
+	o.flushAlign = true
+
+	write := func(v string) {
+		o.writeRecord("", "k="+v, []field{{key: "k", value: v}})
+	}
+
+	write("a")
+	write("bbb")
+	o.tick()
+	if buf.Len() != 0 {
+		t.Fatalf("records written while still arriving: %q", buf.String())
+	}
+	o.tick()
+	if got, want := buf.String(), "k=a\nk=bbb\n"; got != want {
+		t.Fatalf("after an idle tick got %q, want %q", got, want)
+	}
+
+	buf.Reset()
+	o.flushAlign = false
+	write("c")
+	o.tick()
+	o.tick()
+	if buf.Len() != 0 {
+		t.Fatalf("records written without flushAlign: %q", buf.String())
+	}
+	o.close()
+	if got, want := buf.String(), "k=c\n"; got != want {
+		t.Errorf("after close got %q, want %q", got, want)
+	}
+}
+
+func TestOutputLimit(t *testing.T) {
+	tests := []struct {
+		name  string
+		array bool
+		limit int64
+		want  string
+	}{
+		{
+			name:  "lines",
+			limit: 10,
+			want:  "a=1\nb=22\n",
+		},
+		{
+			name:  "exact fit",
+			limit: 9,
+			want:  "a=1\nb=22\n",
+		},
+		{
+			name:  "json array keeps room to close",
+			array: true,
+			limit: 21,
+			want:  "[\n{\"a\":1},\n{\"b\":2}\n]\n",
+		},
+		{
+			name:  "json array too small for any record",
+			array: true,
+			limit: 4,
+			want:  "[]\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			o := newOutput(&buf, 4096)
+			o.limit = tt.limit
+			lines := []string{"a=1", "b=22", "c=333"}
+			if tt.array {
+				o.array = &jsonArray{}
+				lines = []string{`{"a":1}`, `{"b":2}`, `{"c":3}`}
+			}
+			for _, l := range lines {
+				o.writeRecord("", l, nil)
+			}
+			if !o.reachedLimit() {
+				t.Error("limit not reached")
+			}
+			o.close()
+			if got := buf.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordWriterStopsAtLimit(t *testing.T) {
+	var buf bytes.Buffer
+	w := &recordWriter{out: newOutput(&buf, 4096), stats: &runStats{}, stop: make(chan struct{})}
+	w.out.limit = 8
+	for i, line := range []string{"a=1", "b=2", "c=3"} {
+		w.write(item{seq: i, line: line, ok: true})
+	}
+	select {
+	case <-w.stop:
+	default:
+		t.Fatal("reading not stopped at the limit")
+	}
+	w.out.close()
+	if got, want := buf.String(), "a=1\nb=2\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if w.stats.written != 2 {
+		t.Errorf("%d records counted as written, want 2", w.stats.written)
+	}
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/psanford/logfmt/convert"
+)
+
+// item is a unit of work passed from the decoder to the output. Items
+// carry either a decoded record still to be rendered, or an already
+// rendered line (e.g. from -error-field), or a fatal error.
+type item struct {
+	seq       int
+	rec       map[string]interface{}
+	line      string
+	fields    []field
+	ok        bool
+	synthetic bool
+	uniqKey   string
+	group     string
+	// file is the index of the input the record came from and srcLine
+	// the line it started on.
+	file     int
+	srcLine  int
+	sev      severity
+	sevKnown bool
+	// keys is the input order of the record's keys, for
+	// -preserve-order.
+	keys []string
+	// context is set for a record the selection filters rejected,
+	// rendered only to be written as -A, -B or -C context.
+	context bool
+	err     error
+}
+
+// readItems decodes records and calls emit for each one in input order.
+// A fatal decode error is emitted as the final item. Reading also ends
+// early once stop is closed.
+func readItems(records convert.RecordReader, opts convert.Options, stats *runStats, stop <-chan struct{}, emit func(item)) {
+	seq := 0
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		rec, err := records.Next()
+		if err == io.EOF {
+			return
+		} else if lerr, ok := err.(*convert.LineError); ok && *skipErrors {
+			stats.invalid++
+			if *passthroughStderr {
+				fmt.Fprintf(os.Stderr, "%s\n", lerr.Raw)
+				continue
+			}
+			var line string
+			if *passthrough {
+				line = string(lerr.Raw)
+			} else {
+				warnf("skipping invalid input %s", lerr)
+				if !*errorField {
+					continue
+				}
+				line = formatErrorLine(lerr, opts)
+			}
+			it := item{seq: seq, line: line, ok: true, synthetic: true, srcLine: lerr.Line}
+			if m, ok := records.(inputSource); ok {
+				it.file = m.File()
+			}
+			emit(it)
+			seq++
+			continue
+		} else if err != nil {
+			emit(item{seq: seq, err: err})
+			return
+		}
+
+		stats.records++
+		it := item{seq: seq, rec: rec, srcLine: records.Line()}
+		if k, ok := records.(convert.KeyOrderer); ok {
+			it.keys = k.Keys()
+		}
+		if m, ok := records.(inputSource); ok {
+			it.file = m.File()
+			// a JSON null decodes as a nil record, which has nowhere
+			// to put the tag and is written as nothing anyway
+			if *tagSource != "" && rec != nil {
+				rec[*tagSource] = m.Name()
+			}
+		}
+		emit(it)
+		seq++
+	}
+}
+
+// recordWriter is the final stage of the pipeline. It sees rendered
+// items one at a time in input order.
+type recordWriter struct {
+	out   *output
+	stats *runStats
+	// opts formats the -group-by headers, as for the records.
+	opts convert.Options
+
+	uniq *uniqFilter
+
+	// groupBy, if set, writes a header line each time the rendered
+	// value of this field differs from the previous record's.
+	groupBy   string
+	lastGroup *string
+
+	// sampleRate is the probability of writing a record that passed
+	// every filter. Each record is sampled independently.
+	sampleRate float64
+	sampler    *rand.Rand
+
+	// syslog, if set, receives the rendered records in place of out.
+	syslog *syslogSink
+
+	// meta, if set, renders the -emit-meta prefix of each record.
+	meta *metaFormat
+
+	// blankBetween writes an empty line between records, and
+	// blankBetweenFiles only where the input file changes.
+	blankBetween      bool
+	blankBetweenFiles bool
+	wroteAny          bool
+	lastFile          int
+
+	// head, if positive, stops after this many lines have been
+	// written. done is set once no more lines are to be written,
+	// after -head lines or at the -limit-bytes cap, closing stop to
+	// end reading.
+	head  int
+	lines int
+	done  bool
+	stop  chan struct{}
+
+	// tail, if set, holds back the lines to write at EOF.
+	tail *tailBuffer
+
+	// context, if set, picks the context records to write around
+	// matches.
+	context *contextFilter
+}
+
+func (w *recordWriter) write(it item) {
+	if w.done {
+		return
+	}
+	if it.err != nil {
+		w.out.fatal(it.err)
+	}
+	if !it.ok {
+		w.stats.filtered++
+		return
+	}
+	if w.context != nil {
+		for _, it := range w.context.add(it) {
+			w.writeMatched(it)
+		}
+		return
+	}
+	w.writeMatched(it)
+}
+
+// writeMatched writes an item that passed the record filters, or is
+// context for one that did.
+func (w *recordWriter) writeMatched(it item) {
+	if w.uniq == nil {
+		w.emit(it)
+		return
+	}
+	for _, it := range w.uniq.add(it) {
+		w.emit(it)
+	}
+}
+
+// finish writes any items still held by the writer at EOF.
+func (w *recordWriter) finish() {
+	if w.uniq != nil {
+		for _, it := range w.uniq.finish() {
+			w.emit(it)
+		}
+	}
+	if w.tail != nil {
+		for _, it := range w.tail.items() {
+			w.writeItem(it)
+		}
+	}
+}
+
+func (w *recordWriter) emit(it item) {
+	if w.done {
+		return
+	}
+	if it.synthetic {
+		w.output(it)
+		return
+	}
+	if !it.ok {
+		// superseded by a later duplicate under -uniq-keep=last
+		w.stats.filtered++
+		return
+	}
+	if w.sampler != nil && w.sampler.Float64() >= w.sampleRate {
+		w.stats.filtered++
+		return
+	}
+	w.output(it)
+}
+
+// output writes an item that passed every filter, or holds it back for
+// -tail.
+func (w *recordWriter) output(it item) {
+	if w.tail != nil {
+		w.tail.add(it)
+		return
+	}
+	w.writeItem(it)
+}
+
+func (w *recordWriter) writeItem(it item) {
+	if w.done {
+		return
+	}
+	if it.synthetic {
+		w.writeOut(it)
+	} else {
+		if w.groupBy != "" && (w.lastGroup == nil || *w.lastGroup != it.group) {
+			w.writeOut(item{line: fmt.Sprintf("== %s=%s ==", w.opts.FormatKey(w.groupBy), it.group)})
+			group := it.group
+			w.lastGroup = &group
+		}
+		w.writeOut(it)
+	}
+	if w.out.reachedLimit() {
+		// the line was dropped at the -limit-bytes cap
+		w.stopWriting()
+		return
+	}
+	if !it.synthetic {
+		w.stats.written++
+	}
+
+	w.lines++
+	if w.head > 0 && w.lines >= w.head {
+		w.stopWriting()
+	}
+}
+
+// stopWriting drops any further items and ends reading.
+func (w *recordWriter) stopWriting() {
+	if w.done {
+		return
+	}
+	w.done = true
+	if w.stop != nil {
+		close(w.stop)
+	}
+}
+
+// writeOut sends a rendered line to syslog or the output.
+func (w *recordWriter) writeOut(it item) {
+	var meta string
+	if w.meta != nil && it.srcLine > 0 {
+		meta = w.meta.render(it)
+	}
+	if w.syslog == nil {
+		if w.wroteAny && (w.blankBetween || (w.blankBetweenFiles && it.file != w.lastFile)) {
+			w.out.writeRecord("", "", nil)
+		}
+		w.wroteAny = true
+		w.lastFile = it.file
+		w.out.writeRecord(meta, it.line, it.fields)
+		return
+	}
+	line := it.line
+	if meta != "" {
+		line = meta + " " + line
+	}
+	if err := w.syslog.write(it.sev, it.sevKnown, line); err != nil {
+		w.out.fatal(fmt.Errorf("syslog write err: %s", err))
+	}
+}
+
+func runSerial(records convert.RecordReader, c *converter, w *recordWriter) {
+	readItems(records, c.opts, w.stats, w.stop, func(it item) {
+		c.renderItem(&it)
+		w.write(it)
+	})
+}
+
+// runConcurrent decodes records on a single goroutine, renders them on
+// a pool of workers and writes the results in their original input
+// order.
+func runConcurrent(records convert.RecordReader, c *converter, workers int, w *recordWriter) {
+	jobs := make(chan item, workers*4)
+	results := make(chan item, workers*4)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for it := range jobs {
+				c.renderItem(&it)
+				results <- it
+			}
+		}()
+	}
+
+	// the decoder goroutine only touches the read counters and the
+	// writer only the write counters, so stats needs no locking.
+	go func() {
+		readItems(records, c.opts, w.stats, w.stop, func(it item) {
+			jobs <- it
+		})
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	// reorder buffer: hold results that arrive ahead of the next
+	// sequence number we need to write.
+	pending := make(map[int]item)
+	next := 0
+	for it := range results {
+		pending[it.seq] = it
+		for {
+			it, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			w.write(it)
+			next++
+		}
+	}
+}
+
+// maxRawErrorLen bounds how much of an invalid line is copied into
+// the raw field emitted by -error-field.
+const maxRawErrorLen = 256
+
+// formatErrorLine renders a synthetic logfmt line describing an input
+// line that failed to decode.
+func formatErrorLine(e *convert.LineError, opts convert.Options) string {
+	raw := e.Raw
+	truncated := false
+	if len(raw) > maxRawErrorLen {
+		// don't split a multi-byte rune
+		cut := maxRawErrorLen
+		for cut > 0 && !utf8.RuneStart(raw[cut]) {
+			cut--
+		}
+		raw = raw[:cut]
+		truncated = true
+	}
+	rawStr := string(raw)
+	if truncated {
+		rawStr += "..."
+	}
+	return fmt.Sprintf("error=%s raw=%s", opts.EscapeString(e.Err.Error()), opts.EscapeString(rawStr))
+}
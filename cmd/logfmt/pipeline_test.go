@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/psanford/logfmt/convert"
+)
+
+func TestReadItemsTagSource(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []interface{}
+	}{
+		{
+			name:  "records",
+			input: `{"a":1}` + "\n" + `{"b":2}` + "\n",
+			want:  []interface{}{"in.json", "in.json"},
+		},
+		{
+			name:  "null",
+			input: `{"a":1}` + "\nnull\n" + `{"b":2}` + "\n",
+			want:  []interface{}{"in.json", nil, "in.json"},
+		},
+		{
+			name:  "only null",
+			input: "null\n",
+			want:  []interface{}{nil},
+		},
+	}
+
+	old := *tagSource
+	*tagSource = "src"
+	defer func() { *tagSource = old }()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "in.json")
+			if err := os.WriteFile(path, []byte(tt.input), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			m := &multiReader{paths: []string{path}}
+			defer m.close()
+
+			var got []interface{}
+			readItems(m, convert.Options{}, &runStats{}, nil, func(it item) {
+				if it.err != nil {
+					t.Fatal(it.err)
+				}
+				if it.rec == nil {
+					got = append(got, nil)
+					return
+				}
+				got = append(got, filepath.Base(it.rec["src"].(string)))
+			})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// sliceReader is a convert.RecordReader over records held in memory,
+// so that benchmarks measure the pipeline rather than decoding.
+type sliceReader struct {
+	recs []map[string]interface{}
+	i    int
+}
+
+func (r *sliceReader) Next() (map[string]interface{}, error) {
+	if r.i == len(r.recs) {
+		return nil, io.EOF
+	}
+	r.i++
+	return r.recs[r.i-1], nil
+}
+
+func (r *sliceReader) Line() int {
+	return r.i
+}
+
+// benchRecords returns n decoded records with nested objects to
+// flatten and values that need quoting and escaping.
+func benchRecords(b *testing.B, n int) []map[string]interface{} {
+	b.Helper()
+	recs := make([]map[string]interface{}, n)
+	for i := range recs {
+		line := fmt.Sprintf(`{"time":"2024-03-10T12:00:%02d.123Z","level":"info","msg":"request \"%d\" completed in C:\\srv","http":{"method":"GET","path":"/api/v1/users/%d","status":200,"headers":{"user-agent":"curl/8.0 (x86_64)","accept":"*/*"}},"user":{"id":%d,"name":"名前 %d"},"tags":["a","b c"]}`, i%60, i, i, i, i)
+		dec := json.NewDecoder(strings.NewReader(line))
+		dec.UseNumber()
+		if err := dec.Decode(&recs[i]); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return recs
+}
+
+// benchConverter returns the converter for the default flags with
+// the given single valued flags set, restoring them afterwards.
+func benchConverter(b *testing.B, flags map[string]string) *converter {
+	b.Helper()
+	for name, v := range flags {
+		old := flag.Lookup(name).Value.String()
+		if err := flag.Set(name, v); err != nil {
+			b.Fatal(err)
+		}
+		defer flag.Set(name, old)
+	}
+	return converterFromFlags()
+}
+
+// copyRecords returns fresh copies of recs, as the transforms modify
+// records in place.
+func copyRecords(recs []map[string]interface{}) []map[string]interface{} {
+	out := make([]map[string]interface{}, len(recs))
+	for i, rec := range recs {
+		out[i] = copyValue(rec).(map[string]interface{})
+	}
+	return out
+}
+
+func copyValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			m[k] = copyValue(v)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(t))
+		for i, v := range t {
+			a[i] = copyValue(v)
+		}
+		return a
+	}
+	return v
+}
+
+// BenchmarkConcurrency renders records with heavy flattening and
+// escaping through -concurrency's worker pool. Each op is 1000 records;
+// a speedup only shows with several CPUs.
+func BenchmarkConcurrency(b *testing.B) {
+	const n = 1000
+	recs := benchRecords(b, n)
+	c := benchConverter(b, map[string]string{"flatten": "true"})
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				r := &sliceReader{recs: copyRecords(recs)}
+				w := &recordWriter{out: newOutput(io.Discard, 64<<10), stats: &runStats{}}
+				b.StartTimer()
+
+				if workers == 1 {
+					runSerial(r, c, w)
+				} else {
+					runConcurrent(r, c, workers, w)
+				}
+				w.out.close()
+			}
+		})
+	}
+}
+
+// BenchmarkOutput measures the output path alone: rendering
+// transformed records and writing them through the buffered output.
+func BenchmarkOutput(b *testing.B) {
+	recs := benchRecords(b, 100)
+	for _, format := range []string{"logfmt", "json"} {
+		b.Run(format, func(b *testing.B) {
+			c := benchConverter(b, map[string]string{"format": format})
+			w := &recordWriter{out: newOutput(io.Discard, 64<<10), stats: &runStats{}}
+			size := 0
+			for _, rec := range recs {
+				var it item
+				c.renderRecord(&it, rec)
+				size += len(it.line) + 1
+			}
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for seq, rec := range recs {
+					it := item{seq: seq, ok: true}
+					c.renderRecord(&it, rec)
+					w.write(it)
+				}
+			}
+			b.StopTimer()
+			w.out.close()
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// presets hold flag defaults matching the field conventions of common
+// logging libraries.
+var presets = map[string]map[string]string{
+	"zap": {
+		"order":         "ts,level,logger,caller,msg,...,stacktrace",
+		"time-field":    "ts",
+		"level-field":   "level",
+		"level-numbers": "zap",
+	},
+	"logrus": {
+		"order":       "time,level,msg",
+		"time-field":  "time",
+		"level-field": "level",
+	},
+	"slog": {
+		"order":       "time,level,msg",
+		"time-field":  "time",
+		"level-field": "level",
+	},
+	"bunyan": {
+		"order":       "time,level,msg,name,pid",
+		"time-field":  "time",
+		"level-field": "level",
+	},
+}
+
+// applyPreset sets the preset's flag values in fs as if they were the
+// defaults: any flag given explicitly on the command line is left
+// alone, and the preset's values aren't seen by fs.Visit, so checks
+// for explicitly given flags still only see the command line.
+func applyPreset(fs *flag.FlagSet, name string) error {
+	preset, ok := presets[name]
+	if !ok {
+		names := make([]string, 0, len(presets))
+		for n := range presets {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown -preset %q (expected one of %s)", name, strings.Join(names, ", "))
+	}
+
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	for k, v := range preset {
+		if explicit[k] {
+			continue
+		}
+		f := fs.Lookup(k)
+		if f == nil {
+			return fmt.Errorf("-preset %s sets unknown flag -%s", name, k)
+		}
+		// setting the Value directly rather than through fs.Set
+		// doesn't mark the flag as given
+		if err := f.Value.Set(v); err != nil {
+			return fmt.Errorf("-preset %s: invalid -%s: %w", name, k, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestApplyPreset(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		want     map[string]string
+		explicit []string
+	}{
+		{
+			name: "preset values",
+			want: map[string]string{
+				"order":       "ts,level,logger,caller,msg,...,stacktrace",
+				"time-field":  "ts",
+				"level-field": "level",
+			},
+		},
+		{
+			name: "explicit flag overrides preset",
+			args: []string{"-time-field", "when", "-order", "msg"},
+			want: map[string]string{
+				"order":       "msg",
+				"time-field":  "when",
+				"level-field": "level",
+			},
+			explicit: []string{"order", "time-field"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("logfmt", flag.ContinueOnError)
+			fs.String("order", "time,level,msg", "")
+			fs.String("time-field", "time", "")
+			fs.String("level-field", "level", "")
+			fs.String("level-numbers", "", "")
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			if err := applyPreset(fs, "zap"); err != nil {
+				t.Fatal(err)
+			}
+
+			for name, want := range tt.want {
+				if got := fs.Lookup(name).Value.String(); got != want {
+					t.Errorf("-%s = %q, want %q", name, got, want)
+				}
+			}
+
+			// preset values stay defaults, e.g. for -preserve-order
+			// only clearing an -order not given explicitly
+			var visited []string
+			fs.Visit(func(f *flag.Flag) {
+				visited = append(visited, f.Name)
+			})
+			if len(visited) != len(tt.explicit) {
+				t.Fatalf("explicitly set flags %v, want %v", visited, tt.explicit)
+			}
+			for i, name := range tt.explicit {
+				if visited[i] != name {
+					t.Errorf("explicitly set flags %v, want %v", visited, tt.explicit)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyPresetUnknown(t *testing.T) {
+	if err := applyPreset(flag.NewFlagSet("logfmt", flag.ContinueOnError), "log4j"); err == nil {
+		t.Error("no error for an unknown preset")
+	}
+}
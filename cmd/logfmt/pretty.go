@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/psanford/logfmt/convert"
+)
+
+// prettyIndent prefixes the body lines of a -format=pretty record, and
+// prettyBlockIndent the lines of a block value.
+const (
+	prettyIndent      = "  "
+	prettyBlockIndent = "      "
+)
+
+// prettyBlockLen is the length above which a string value is written
+// as a block rather than inline.
+const prettyBlockLen = 80
+
+// formatPretty renders rec across several lines for -format=pretty: a
+// header holding the plain time, level and message, then each other
+// field indented on a line of its own. Strings that span lines or are
+// longer than prettyBlockLen, such as stack traces, are written
+// unescaped as an indented block under their key.
+func (c *converter) formatPretty(rec map[string]interface{}, sortedFields []string, dropped int) string {
+	var b strings.Builder
+	used := make(map[string]bool)
+	var header []string
+	for _, candidates := range c.prettyHeader {
+		for _, k := range candidates {
+			if v, ok := rec[k]; ok && v != nil && !used[k] {
+				header = append(header, convert.PlainValue(v))
+				used[k] = true
+				break
+			}
+		}
+	}
+	b.WriteString(strings.Join(header, " "))
+
+	for _, k := range sortedFields {
+		if used[k] {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte('\n')
+		}
+		key := shortenKey(c.opts.FormatKey(k), c.maxKeyLen)
+		s, ok := rec[k].(string)
+		if !ok || (!strings.Contains(s, "\n") && len(s) <= prettyBlockLen) {
+			b.WriteString(prettyIndent + key + "=" + c.formatValue(k, rec[k]))
+			continue
+		}
+		b.WriteString(prettyIndent + key + ":")
+		for _, l := range strings.Split(strings.TrimRight(s, "\n"), "\n") {
+			b.WriteString("\n" + prettyBlockIndent + strings.TrimSuffix(l, "\r"))
+		}
+	}
+	if dropped > 0 {
+		fmt.Fprintf(&b, "\n%s…+%d", prettyIndent, dropped)
+	}
+	return b.String()
+}
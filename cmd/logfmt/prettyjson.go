@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// prettyJSON writes indented JSON, optionally with ANSI colored keys
+// and values.
+type prettyJSON struct {
+	buf   bytes.Buffer
+	color bool
+}
+
+// formatPrettyJSON renders rec as indented JSON with its top level keys
+// in the order given by sortedFields.
+func formatPrettyJSON(rec map[string]interface{}, sortedFields []string, color bool) (string, error) {
+	p := &prettyJSON{color: color}
+	if err := p.object(rec, sortedFields, 0); err != nil {
+		return "", err
+	}
+	return p.buf.String(), nil
+}
+
+func (p *prettyJSON) paint(color, s string) {
+	if p.color {
+		p.buf.WriteString(color)
+		p.buf.WriteString(s)
+		p.buf.WriteString(ansiReset)
+		return
+	}
+	p.buf.WriteString(s)
+}
+
+func (p *prettyJSON) newline(depth int) {
+	p.buf.WriteByte('\n')
+	p.buf.WriteString(strings.Repeat("  ", depth))
+}
+
+func (p *prettyJSON) object(m map[string]interface{}, keys []string, depth int) error {
+	if len(m) == 0 {
+		p.buf.WriteString("{}")
+		return nil
+	}
+	if keys == nil {
+		keys = make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+	}
+
+	p.buf.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			p.buf.WriteByte(',')
+		}
+		p.newline(depth + 1)
+		kb, err := marshalJSON(k)
+		if err != nil {
+			return err
+		}
+		p.paint(ansiBlue, string(kb))
+		p.buf.WriteString(": ")
+		if err := p.value(m[k], depth+1); err != nil {
+			return err
+		}
+	}
+	p.newline(depth)
+	p.buf.WriteByte('}')
+	return nil
+}
+
+func (p *prettyJSON) value(v interface{}, depth int) error {
+	switch t := v.(type) {
+	case nil:
+		p.paint(ansiGray, "null")
+	case bool:
+		if t {
+			p.paint(ansiMagenta, "true")
+		} else {
+			p.paint(ansiMagenta, "false")
+		}
+	case json.Number:
+		p.paint(ansiCyan, t.String())
+	case string:
+		b, err := marshalJSON(t)
+		if err != nil {
+			return err
+		}
+		p.paint(ansiGreen, string(b))
+	case map[string]interface{}:
+		return p.object(t, nil, depth)
+	case []interface{}:
+		if len(t) == 0 {
+			p.buf.WriteString("[]")
+			return nil
+		}
+		p.buf.WriteByte('[')
+		for i, elem := range t {
+			if i > 0 {
+				p.buf.WriteByte(',')
+			}
+			p.newline(depth + 1)
+			if err := p.value(elem, depth+1); err != nil {
+				return err
+			}
+		}
+		p.newline(depth)
+		p.buf.WriteByte(']')
+	default:
+		b, err := marshalJSON(t)
+		if err != nil {
+			return err
+		}
+		p.paint(ansiCyan, string(b))
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/psanford/logfmt/convert"
+)
+
+// redactedValue replaces the values of fields matched by -redact.
+const redactedValue = "[REDACTED]"
+
+// redactor implements -redact. Patterns are keyPattern globs, as for
+// -exclude, matched case insensitively against whole keys and against
+// the dotted path of values nested in objects and arrays, where array
+// elements are keyed by index. So *.secret matches a flattened
+// auth.secret, the secret key of {"auth":{...}} and that of
+// {"users":[{...}]} at users.0.secret.
+type redactor struct {
+	keys  map[string]bool
+	globs []keyPattern
+	// hash replaces values with a short SHA-256 of their text rather
+	// than a fixed marker, so equal values can still be correlated.
+	hash bool
+}
+
+// newRedactor parses the comma separated -redact patterns. It returns
+// nil if there are none.
+func newRedactor(list, mode string) (*redactor, error) {
+	r := &redactor{keys: make(map[string]bool)}
+	switch mode {
+	case "mask":
+	case "hash":
+		r.hash = true
+	default:
+		return nil, fmt.Errorf("unknown -redact-mode %q (expected mask or hash)", mode)
+	}
+	var err error
+	if r.globs, err = splitPatterns(strings.ToLower(list), r.keys); err != nil {
+		return nil, fmt.Errorf("invalid -redact: %s", err)
+	}
+	if len(r.keys) == 0 && len(r.globs) == 0 {
+		return nil, nil
+	}
+	return r, nil
+}
+
+func (r *redactor) apply(rec map[string]interface{}) {
+	r.redactIn(rec, "")
+}
+
+func (r *redactor) redactIn(m map[string]interface{}, prefix string) {
+	for k, v := range m {
+		m[k] = r.redactValue(v, prefix+k)
+	}
+}
+
+// redactValue returns v, found at the dotted path key, redacted if the
+// path matches or with any matching values nested in it redacted.
+func (r *redactor) redactValue(v interface{}, key string) interface{} {
+	if matchAny(strings.ToLower(key), r.keys, r.globs) {
+		return r.value(v)
+	}
+	switch t := v.(type) {
+	case map[string]interface{}:
+		r.redactIn(t, key+".")
+	case []interface{}:
+		for i, elem := range t {
+			t[i] = r.redactValue(elem, key+"."+strconv.Itoa(i))
+		}
+	}
+	return v
+}
+
+func (r *redactor) value(v interface{}) interface{} {
+	if !r.hash {
+		return redactedValue
+	}
+	text := "null"
+	if v != nil {
+		text = convert.PlainValue(v)
+	}
+	sum := sha256.Sum256([]byte(text))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// String describes the redaction for -dry-run.
+func (r *redactor) String() string {
+	mode := "mask"
+	if r.hash {
+		mode = "hash"
+	}
+	return strings.Join(patternList(r.keys, r.globs), ",") + " (mode=" + mode + ")"
+}
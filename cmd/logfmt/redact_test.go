@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns string
+		in       string
+		want     string
+	}{
+		{
+			name:     "top level key",
+			patterns: "password",
+			in:       `{"password":"hunter2","user":"bob"}`,
+			want:     `{"password":"[REDACTED]","user":"bob"}`,
+		},
+		{
+			name:     "case insensitive",
+			patterns: "Authorization",
+			in:       `{"authorization":"Bearer x"}`,
+			want:     `{"authorization":"[REDACTED]"}`,
+		},
+		{
+			name:     "nested object",
+			patterns: "*.secret",
+			in:       `{"auth":{"secret":"s","user":"bob"}}`,
+			want:     `{"auth":{"secret":"[REDACTED]","user":"bob"}}`,
+		},
+		{
+			name:     "objects in an array",
+			patterns: "password,*.password",
+			in:       `{"users":[{"password":"hunter2"},{"password":"p","name":"a"}]}`,
+			want:     `{"users":[{"password":"[REDACTED]"},{"name":"a","password":"[REDACTED]"}]}`,
+		},
+		{
+			name:     "nested arrays",
+			patterns: "*.token",
+			in:       `{"a":[["x",{"token":"t"}]]}`,
+			want:     `{"a":[["x",{"token":"[REDACTED]"}]]}`,
+		},
+		{
+			name:     "array element by index",
+			patterns: "args.1",
+			in:       `{"args":["-u","hunter2"]}`,
+			want:     `{"args":["-u","[REDACTED]"]}`,
+		},
+		{
+			name:     "flattened key with slashes",
+			patterns: "kubernetes.*",
+			in:       `{"kubernetes.labels.app.kubernetes.io/name":"web","msg":"hi"}`,
+			want:     `{"kubernetes.labels.app.kubernetes.io/name":"[REDACTED]","msg":"hi"}`,
+		},
+		{
+			name:     "nested key with slashes",
+			patterns: "*/name",
+			in:       `{"kubernetes":{"labels":{"app.kubernetes.io/name":"web"}}}`,
+			want:     `{"kubernetes":{"labels":{"app.kubernetes.io/name":"[REDACTED]"}}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := newRedactor(tt.patterns, "mask")
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec := decodeTestRecord(t, tt.in)
+			r.apply(rec)
+			if want := decodeTestRecord(t, tt.want); !reflect.DeepEqual(rec, want) {
+				t.Errorf("got %v, want %v", rec, want)
+			}
+		})
+	}
+}
+
+func TestRedactHash(t *testing.T) {
+	r, err := newRedactor("token", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := map[string]interface{}{"token": "t1"}
+	b := map[string]interface{}{"token": "t1"}
+	c := map[string]interface{}{"token": "t2"}
+	r.apply(a)
+	r.apply(b)
+	r.apply(c)
+	if a["token"] != b["token"] || a["token"] == c["token"] {
+		t.Errorf("hashes of t1, t1, t2: %v, %v, %v", a["token"], b["token"], c["token"])
+	}
+	if a["token"] != "sha256:628b49d96dcde97a" {
+		t.Errorf("hash of t1 = %v", a["token"])
+	}
+}
+
+// decodeTestRecord decodes s as the input decoders do, with numbers as
+// json.Number.
+func decodeTestRecord(t *testing.T, s string) map[string]interface{} {
+	t.Helper()
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var rec map[string]interface{}
+	if err := dec.Decode(&rec); err != nil {
+		t.Fatalf("decode %s: %s", s, err)
+	}
+	return rec
+}
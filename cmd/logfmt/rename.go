@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// fieldRename moves the value of one field to another key. from may be
+// a dotted path into nested objects. ifAbsent renames only when the
+// record doesn't already have to, as -normalize does.
+type fieldRename struct {
+	from     string
+	to       string
+	ifAbsent bool
+}
+
+func parseRename(spec string) (fieldRename, error) {
+	idx := strings.Index(spec, "=")
+	if idx < 1 || idx == len(spec)-1 {
+		return fieldRename{}, fmt.Errorf("invalid -rename %q, expected old=new", spec)
+	}
+	return fieldRename{from: spec[:idx], to: spec[idx+1:]}, nil
+}
+
+// normalizeRenames are the -normalize renames, in order of preference:
+// the first variant of a key present in a record is the one used.
+var normalizeRenames = []fieldRename{
+	{from: "ts", to: "time", ifAbsent: true},
+	{from: "@timestamp", to: "time", ifAbsent: true},
+	{from: "timestamp", to: "time", ifAbsent: true},
+	{from: "log.level", to: "level", ifAbsent: true},
+	{from: "severity", to: "level", ifAbsent: true},
+	{from: "lvl", to: "level", ifAbsent: true},
+	{from: "message", to: "msg", ifAbsent: true},
+}
+
+func (r fieldRename) apply(rec map[string]interface{}, collide *collider) error {
+	parent, leaf, ok := lookupPath(rec, r.from)
+	if !ok {
+		return nil
+	}
+	if _, exists := rec[r.to]; exists && r.ifAbsent {
+		return nil
+	}
+	v := parent[leaf]
+	delete(parent, leaf)
+	return collide.set(rec, r.to, v)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// valueReplacer is a -replace regex substitution applied to string
+// values.
+type valueReplacer struct {
+	re   *regexp.Regexp
+	repl string
+}
+
+// parseReplace parses a sed style /regex/replacement/ spec. Any
+// character may be used as the delimiter and a backslash escapes it
+// within either part. The replacement may reference capture groups as
+// $1 or ${name}.
+func parseReplace(spec string) (*valueReplacer, error) {
+	if len(spec) < 2 {
+		return nil, fmt.Errorf("invalid -replace %q, expected /regex/replacement/", spec)
+	}
+	delim := spec[0]
+
+	var parts []string
+	var cur strings.Builder
+	for i := 1; i < len(spec); i++ {
+		ch := spec[i]
+		if ch == '\\' && i+1 < len(spec) && spec[i+1] == delim {
+			cur.WriteByte(delim)
+			i++
+			continue
+		}
+		if ch == delim {
+			parts = append(parts, cur.String())
+			cur.Reset()
+			continue
+		}
+		cur.WriteByte(ch)
+	}
+	if cur.Len() > 0 || len(parts) < 2 {
+		parts = append(parts, cur.String())
+	}
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid -replace %q, expected /regex/replacement/", spec)
+	}
+
+	re, err := regexp.Compile(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid -replace regex: %w", err)
+	}
+	return &valueReplacer{re: re, repl: parts[1]}, nil
+}
+
+// applyReplacers runs each replacer over the string values of rec. If
+// fields is non-empty only those fields are touched.
+func applyReplacers(rec map[string]interface{}, replacers []*valueReplacer, fields map[string]bool) {
+	for k, v := range rec {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		if len(fields) > 0 && !fields[k] {
+			continue
+		}
+		for _, r := range replacers {
+			s = r.re.ReplaceAllString(s, r.repl)
+		}
+		rec[k] = s
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// fieldSelector implements -only and -exclude. Patterns are keyPattern
+// globs matched against whole keys and the dotted paths of nested
+// ones, so kubernetes.* matches every kubernetes key, flattened or not.
+type fieldSelector struct {
+	only    []keyPattern
+	exclude []keyPattern
+
+	// plain patterns, the common case, are looked up directly
+	onlyKeys    map[string]bool
+	excludeKeys map[string]bool
+}
+
+// newFieldSelector parses the comma separated -only and -exclude
+// patterns. It returns nil if both are empty.
+func newFieldSelector(only, exclude string) (*fieldSelector, error) {
+	if only == "" && exclude == "" {
+		return nil, nil
+	}
+	s := &fieldSelector{onlyKeys: make(map[string]bool), excludeKeys: make(map[string]bool)}
+	var err error
+	if s.only, err = splitPatterns(only, s.onlyKeys); err != nil {
+		return nil, fmt.Errorf("invalid -only: %s", err)
+	}
+	if s.exclude, err = splitPatterns(exclude, s.excludeKeys); err != nil {
+		return nil, fmt.Errorf("invalid -exclude: %s", err)
+	}
+	return s, nil
+}
+
+// splitPatterns adds the patterns in list without wildcards to keys and
+// returns the rest.
+func splitPatterns(list string, keys map[string]bool) ([]keyPattern, error) {
+	var globs []keyPattern
+	for _, p := range splitList(list) {
+		if !strings.ContainsAny(p, `*?[\`) {
+			keys[p] = true
+			continue
+		}
+		g, err := compileKeyPattern(p)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %s", p, err)
+		}
+		globs = append(globs, g)
+	}
+	return globs, nil
+}
+
+func matchAny(key string, keys map[string]bool, globs []keyPattern) bool {
+	if keys[key] {
+		return true
+	}
+	for _, g := range globs {
+		if g.re.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// patternList returns the patterns split by splitPatterns, for
+// -dry-run.
+func patternList(keys map[string]bool, globs []keyPattern) []string {
+	list := sortedSet(keys)
+	for _, g := range globs {
+		list = append(list, g.src)
+	}
+	return list
+}
+
+// apply removes the fields of rec that aren't selected. Fields in
+// nested objects are matched by their dotted path, so -exclude
+// kubernetes.* applies whether or not -flatten is set. With -only a
+// field is kept if it, or an object holding it, matches one of its
+// patterns, and no field matching an -exclude pattern is kept. An
+// object left empty by the selection is removed.
+func (s *fieldSelector) apply(rec map[string]interface{}) {
+	s.selectIn(rec, "", len(s.onlyKeys) > 0 || len(s.only) > 0)
+}
+
+// selectIn applies the selection to the fields of m, whose keys are
+// prefixed by prefix in the dotted path. restrict is set while no
+// object holding m has matched -only.
+func (s *fieldSelector) selectIn(m map[string]interface{}, prefix string, restrict bool) {
+	for k, v := range m {
+		key := prefix + k
+		if matchAny(key, s.excludeKeys, s.exclude) {
+			delete(m, k)
+			continue
+		}
+		keep := !restrict || matchAny(key, s.onlyKeys, s.only)
+		nested, ok := v.(map[string]interface{})
+		if !ok || len(nested) == 0 {
+			if !keep {
+				delete(m, k)
+			}
+			continue
+		}
+		s.selectIn(nested, key+".", !keep)
+		if len(nested) == 0 {
+			delete(m, k)
+		}
+	}
+}
+
+// String describes the selection for -dry-run.
+func (s *fieldSelector) String() string {
+	var parts []string
+	if list := patternList(s.onlyKeys, s.only); len(list) > 0 {
+		parts = append(parts, "only="+strings.Join(list, ","))
+	}
+	if list := patternList(s.excludeKeys, s.exclude); len(list) > 0 {
+		parts = append(parts, "exclude="+strings.Join(list, ","))
+	}
+	return strings.Join(parts, " ")
+}
+
+// keyPattern is a glob over dotted keys, in path.Match syntax except
+// that * matches any run of characters, dots and slashes included:
+// kubernetes.* matches kubernetes.labels.app.kubernetes.io/name and
+// *.secret matches a secret key at any depth.
+type keyPattern struct {
+	src string
+	re  *regexp.Regexp
+}
+
+// compileKeyPattern translates the glob p to an anchored regexp.
+func compileKeyPattern(p string) (keyPattern, error) {
+	var b strings.Builder
+	b.WriteString(`^(?s:`)
+	for i := 0; i < len(p); i++ {
+		switch c := p[i]; c {
+		case '*':
+			b.WriteString(`.*`)
+		case '?':
+			b.WriteString(`.`)
+		case '[':
+			end, err := writeGlobClass(&b, p, i+1)
+			if err != nil {
+				return keyPattern{}, err
+			}
+			i = end
+		case '\\':
+			i++
+			if i == len(p) {
+				return keyPattern{}, errors.New("trailing backslash")
+			}
+			fallthrough
+		default:
+			b.WriteString(regexp.QuoteMeta(p[i : i+1]))
+		}
+	}
+	b.WriteString(`)$`)
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return keyPattern{}, err
+	}
+	return keyPattern{src: p, re: re}, nil
+}
+
+// writeGlobClass writes the character class starting at p[start], just
+// after its [, as a regexp class and returns the offset of its closing
+// ]. As in path.Match a class may be negated with ^, holds single
+// characters and lo-hi ranges, and \ escapes the next character.
+func writeGlobClass(b *strings.Builder, p string, start int) (int, error) {
+	i := start
+	b.WriteByte('[')
+	if i < len(p) && p[i] == '^' {
+		b.WriteByte('^')
+		i++
+	}
+	empty := true
+	for {
+		if i == len(p) {
+			return 0, errors.New("unterminated character class")
+		}
+		if p[i] == ']' && !empty {
+			b.WriteByte(']')
+			return i, nil
+		}
+		lo, next, err := globClassChar(p, i)
+		if err != nil {
+			return 0, err
+		}
+		fmt.Fprintf(b, `\x{%x}`, lo)
+		i = next
+		if i < len(p) && p[i] == '-' {
+			hi, next, err := globClassChar(p, i+1)
+			if err != nil {
+				return 0, err
+			}
+			if hi < lo {
+				return 0, errors.New("invalid character range")
+			}
+			fmt.Fprintf(b, `-\x{%x}`, hi)
+			i = next
+		}
+		empty = false
+	}
+}
+
+// globClassChar returns the possibly escaped character at p[i] within
+// a class and the offset after it.
+func globClassChar(p string, i int) (rune, int, error) {
+	escaped := i < len(p) && p[i] == '\\'
+	if escaped {
+		i++
+	}
+	if i == len(p) || (!escaped && (p[i] == ']' || p[i] == '-')) {
+		return 0, 0, errors.New("invalid character class")
+	}
+	r, size := utf8.DecodeRuneInString(p[i:])
+	return r, i + size, nil
+}
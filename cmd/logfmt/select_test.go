@@ -0,0 +1,131 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKeyPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		key     string
+		want    bool
+	}{
+		{"kubernetes.*", "kubernetes.pod", true},
+		{"kubernetes.*", "kubernetes.labels.app.kubernetes.io/name", true},
+		{"kubernetes.*", "kubernetes", false},
+		{"kubernetes.*", "kube.pod", false},
+		{"*.secret", "auth.secret", true},
+		{"*.secret", "users.0.secret", true},
+		{"*.secret", "secret", false},
+		{"*/name", "app.kubernetes.io/name", true},
+		{"a?c", "abc", true},
+		{"a?c", "a/c", true},
+		{"a?c", "aé c", false},
+		{"a?c", "aéc", true},
+		{"item[0-9]", "item7", true},
+		{"item[0-9]", "itemx", false},
+		{"item[^0-9]", "itemx", true},
+		{"[ab]*", "bcd", true},
+		{`a\*`, "a*", true},
+		{`a\*`, "ab", false},
+		{"a.b", "axb", false},
+		{"a+b", "a+b", true},
+		{"(x)*", "(x)y", true},
+	}
+
+	for _, tt := range tests {
+		p, err := compileKeyPattern(tt.pattern)
+		if err != nil {
+			t.Errorf("compile %q: %s", tt.pattern, err)
+			continue
+		}
+		if got := p.re.MatchString(tt.key); got != tt.want {
+			t.Errorf("%q match %q = %t, want %t", tt.pattern, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestKeyPatternErrors(t *testing.T) {
+	for _, p := range []string{"a[", "a[]", `a\`, "[z-a]", "[a-]", "[-a]"} {
+		if _, err := compileKeyPattern(p); err == nil {
+			t.Errorf("compile %q: no error", p)
+		}
+	}
+}
+
+func TestFieldSelector(t *testing.T) {
+	const nested = `{"msg":"hi","kubernetes":{"pod":"p","labels":{"app.kubernetes.io/name":"web"}},"http":{"method":"GET","path":"/"}}`
+	const flat = `{"msg":"hi","kubernetes.pod":"p","kubernetes.labels.app.kubernetes.io/name":"web","http.method":"GET"}`
+
+	tests := []struct {
+		name          string
+		only, exclude string
+		in            string
+		want          string
+	}{
+		{
+			name:    "exclude nested object",
+			exclude: "kubernetes.*",
+			in:      nested,
+			want:    `{"msg":"hi","http":{"method":"GET","path":"/"}}`,
+		},
+		{
+			name:    "exclude flattened keys with slashes",
+			exclude: "kubernetes.*",
+			in:      flat,
+			want:    `{"msg":"hi","http.method":"GET"}`,
+		},
+		{
+			name:    "exclude nested field",
+			exclude: "*/name,http.path",
+			in:      nested,
+			want:    `{"msg":"hi","kubernetes":{"pod":"p"},"http":{"method":"GET"}}`,
+		},
+		{
+			name: "only nested fields",
+			only: "msg,http.method",
+			in:   nested,
+			want: `{"msg":"hi","http":{"method":"GET"}}`,
+		},
+		{
+			name: "only keeps a matched object whole",
+			only: "kubernetes",
+			in:   nested,
+			want: `{"kubernetes":{"pod":"p","labels":{"app.kubernetes.io/name":"web"}}}`,
+		},
+		{
+			name:    "exclude inside an only match",
+			only:    "kubernetes",
+			exclude: "kubernetes.labels",
+			in:      nested,
+			want:    `{"kubernetes":{"pod":"p"}}`,
+		},
+		{
+			name: "only flattened glob",
+			only: "kubernetes.*",
+			in:   flat,
+			want: `{"kubernetes.pod":"p","kubernetes.labels.app.kubernetes.io/name":"web"}`,
+		},
+		{
+			name:    "empty object kept",
+			exclude: "caller",
+			in:      `{"ctx":{},"caller":"x"}`,
+			want:    `{"ctx":{}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newFieldSelector(tt.only, tt.exclude)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec := decodeTestRecord(t, tt.in)
+			s.apply(rec)
+			if want := decodeTestRecord(t, tt.want); !reflect.DeepEqual(rec, want) {
+				t.Errorf("got %v, want %v", rec, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/psanford/logfmt/convert"
+)
+
+// statsBy and statsTop are the flags of the stats subcommand, only
+// registered when it runs.
+var (
+	statsBy  *string
+	statsTop *int
+)
+
+func registerStatsFlags() {
+	statsBy = flag.String("by", "level", "stats: comma separated fields to group records by; a record missing one counts under an empty value")
+	statsTop = flag.Int("top", 10, "stats: number of groups to list, most frequent first, with the rest summed as other (0 for all)")
+}
+
+// statsAgg counts the records written by the stats subcommand per
+// distinct value of the -by fields, and the span of their times for
+// rates.
+type statsAgg struct {
+	by         []string
+	top        int
+	timeFields []string
+	opts       convert.Options
+
+	total  int
+	groups map[string]*statsGroup
+
+	haveTime    bool
+	first, last time.Time
+}
+
+type statsGroup struct {
+	values []interface{}
+	count  int
+}
+
+func newStatsAgg(by []string, top int, timeFields []string, opts convert.Options) *statsAgg {
+	return &statsAgg{by: by, top: top, timeFields: timeFields, opts: opts, groups: make(map[string]*statsGroup)}
+}
+
+// addTime widens the time span to include ts.
+func (s *statsAgg) addTime(ts time.Time) {
+	if !s.haveTime || ts.Before(s.first) {
+		s.first = ts
+	}
+	if !s.haveTime || ts.After(s.last) {
+		s.last = ts
+	}
+	s.haveTime = true
+}
+
+func (s *statsAgg) add(rec map[string]interface{}) {
+	s.total++
+	values := make([]interface{}, len(s.by))
+	keys := make([]string, len(s.by))
+	for i, f := range s.by {
+		values[i] = ""
+		if parent, leaf, ok := lookupPath(rec, f); ok {
+			values[i] = parent[leaf]
+		}
+		keys[i] = s.opts.FormatValue(f, values[i])
+	}
+	key := strings.Join(keys, " ")
+	g := s.groups[key]
+	if g == nil {
+		g = &statsGroup{values: values}
+		s.groups[key] = g
+	}
+	g.count++
+}
+
+// summary returns the summary records: the totals, then one per group
+// in order of count, ties broken by value. Each record comes with its
+// keys in output order.
+func (s *statsAgg) summary() ([]map[string]interface{}, [][]string) {
+	var recs []map[string]interface{}
+	var order [][]string
+
+	minutes := 0.0
+	if s.haveTime {
+		minutes = s.last.Sub(s.first).Minutes()
+	}
+	rate := func(rec map[string]interface{}, keys []string, count int) []string {
+		if minutes > 0 {
+			rec["per_min"] = floatNumber(roundTo(float64(count)/minutes, 2))
+			keys = append(keys, "per_min")
+		}
+		return keys
+	}
+
+	total := map[string]interface{}{"records": s.total, "groups": len(s.groups)}
+	keys := []string{"records", "groups"}
+	if s.haveTime {
+		total["first"] = s.first.Format(time.RFC3339Nano)
+		total["last"] = s.last.Format(time.RFC3339Nano)
+		total["span"] = s.last.Sub(s.first).String()
+		keys = append(keys, "first", "last", "span")
+	}
+	recs = append(recs, total)
+	order = append(order, rate(total, keys, s.total))
+
+	groupKeys := make([]string, 0, len(s.groups))
+	for k := range s.groups {
+		groupKeys = append(groupKeys, k)
+	}
+	sort.Slice(groupKeys, func(i, j int) bool {
+		a, b := s.groups[groupKeys[i]], s.groups[groupKeys[j]]
+		if a.count != b.count {
+			return a.count > b.count
+		}
+		return groupKeys[i] < groupKeys[j]
+	})
+
+	pct := func(count int) json.Number {
+		return floatNumber(roundTo(100*float64(count)/float64(s.total), 1))
+	}
+	for i, k := range groupKeys {
+		if s.top > 0 && i == s.top {
+			other, count := len(groupKeys)-i, 0
+			for _, k := range groupKeys[i:] {
+				count += s.groups[k].count
+			}
+			rec := map[string]interface{}{"other": other, "count": count, "pct": pct(count)}
+			recs = append(recs, rec)
+			order = append(order, rate(rec, []string{"other", "count", "pct"}, count))
+			break
+		}
+		g := s.groups[k]
+		rec := map[string]interface{}{"count": g.count, "pct": pct(g.count)}
+		var keys []string
+		for i, f := range s.by {
+			rec[f] = g.values[i]
+			keys = append(keys, f)
+		}
+		recs = append(recs, rec)
+		order = append(order, rate(rec, append(keys, "count", "pct"), g.count))
+	}
+	return recs, order
+}
+
+// roundTo rounds f to places decimal places.
+func roundTo(f float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(f*scale) / scale
+}
+
+// runStatsCommand reads and transforms every record like a normal run
+// but writes only the stats summary, as logfmt or -format=json
+// records.
+func runStatsCommand(records convert.RecordReader, c *converter, out *output, stats *runStats) {
+	agg := newStatsAgg(splitList(*statsBy), *statsTop, splitList(*timeField), c.opts)
+	readItems(records, c.opts, stats, nil, func(it item) {
+		if it.err != nil {
+			out.fatal(it.err)
+		}
+		if it.rec == nil {
+			// an invalid line, under -skip-errors
+			return
+		}
+		ts, _, _, hasTime := findTime(it.rec, agg.timeFields)
+		rec, ok, err := c.transform(it.rec, it.file)
+		if err != nil {
+			out.fatal(err)
+		}
+		if !ok {
+			stats.filtered++
+			return
+		}
+		if hasTime {
+			agg.addTime(ts)
+		}
+		agg.add(rec)
+		stats.written++
+	})
+
+	recs, order := agg.summary()
+	for i, rec := range recs {
+		if c.format == "json" {
+			line, err := formatJSONRecord(rec, order[i], false, "")
+			if err != nil {
+				out.fatal(err)
+			}
+			out.writeLine(line)
+			continue
+		}
+		fields := make([]field, len(order[i]))
+		for j, k := range order[i] {
+			fields[j] = field{key: c.opts.FormatKey(k), value: c.opts.FormatValue(k, rec[k])}
+		}
+		out.writeLine(joinFields(fields))
+	}
+}
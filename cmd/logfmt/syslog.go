@@ -0,0 +1,55 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package main
+
+import (
+	"log/syslog"
+	"strings"
+)
+
+// syslogSink writes rendered records to syslog instead of stdout.
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+// dialSyslog connects to the syslog daemon at addr, which is either
+// empty for the local daemon or [network://]host:port with network
+// defaulting to udp.
+func dialSyslog(addr, tag string) (*syslogSink, error) {
+	var network string
+	if addr != "" {
+		network = "udp"
+		if i := strings.Index(addr, "://"); i >= 0 {
+			network, addr = addr[:i], addr[i+3:]
+		}
+	}
+	w, err := syslog.Dial(network, addr, syslog.LOG_INFO|syslog.LOG_USER, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogSink{w: w}, nil
+}
+
+// write sends line at the syslog priority matching sev. Records
+// without a recognized level are sent at info.
+func (s *syslogSink) write(sev severity, known bool, line string) error {
+	if !known {
+		return s.w.Info(line)
+	}
+	switch sev {
+	case sevTrace, sevDebug:
+		return s.w.Debug(line)
+	case sevWarn:
+		return s.w.Warning(line)
+	case sevError:
+		return s.w.Err(line)
+	case sevFatal:
+		return s.w.Crit(line)
+	}
+	return s.w.Info(line)
+}
+
+func (s *syslogSink) close() error {
+	return s.w.Close()
+}
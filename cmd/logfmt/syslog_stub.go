@@ -0,0 +1,21 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package main
+
+import "errors"
+
+// syslogSink is unavailable on platforms without log/syslog.
+type syslogSink struct{}
+
+func dialSyslog(addr, tag string) (*syslogSink, error) {
+	return nil, errors.New("-syslog is not supported on this platform")
+}
+
+func (s *syslogSink) write(sev severity, known bool, line string) error {
+	return nil
+}
+
+func (s *syslogSink) close() error {
+	return nil
+}
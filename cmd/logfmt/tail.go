@@ -0,0 +1,29 @@
+package main
+
+// tailBuffer is a ring holding the last n items written, for -tail.
+type tailBuffer struct {
+	ring []item
+	next int
+	full bool
+}
+
+func newTailBuffer(n int) *tailBuffer {
+	return &tailBuffer{ring: make([]item, n)}
+}
+
+func (t *tailBuffer) add(it item) {
+	t.ring[t.next] = it
+	t.next++
+	if t.next == len(t.ring) {
+		t.next = 0
+		t.full = true
+	}
+}
+
+// items returns the buffered items, oldest first.
+func (t *tailBuffer) items() []item {
+	if !t.full {
+		return t.ring[:t.next]
+	}
+	return append(t.ring[t.next:len(t.ring):len(t.ring)], t.ring[:t.next]...)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/psanford/logfmt/convert"
+)
+
+// restKey holds the pre-rendered result of the rest function in the
+// data passed to a -template. Field references can't contain a NUL,
+// so it never clashes with a record key.
+const restKey = "\x00rest"
+
+// recordTemplate renders records with a -template. Fields are passed as
+// their plain text, so {{.msg}} writes the message unquoted and a
+// missing field is the empty string.
+type recordTemplate struct {
+	src  string
+	tmpl *template.Template
+	// used holds the fields the template refers to, which rest leaves
+	// out. hasRest is set if rest is called at all.
+	used    map[string]bool
+	hasRest bool
+}
+
+func parseRecordTemplate(src string) (*recordTemplate, error) {
+	t, err := template.New("record").Option("missingkey=zero").Funcs(templateFuncs).Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -template: %s", err)
+	}
+	rt := &recordTemplate{src: src, tmpl: t, used: make(map[string]bool)}
+	rt.walk(t.Tree.Root)
+	return rt, nil
+}
+
+var templateFuncs = template.FuncMap{
+	"upper":   strings.ToUpper,
+	"lower":   strings.ToLower,
+	"pad":     padRight,
+	"padLeft": padLeft,
+	"trunc":   truncateWidth,
+	"default": func(def, s string) string {
+		if s == "" {
+			return def
+		}
+		return s
+	},
+	"rest": func(data map[string]string) string {
+		return data[restKey]
+	},
+}
+
+// padRight pads s with spaces to width columns.
+func padRight(width int, s string) string {
+	if w := displayWidth(s); w < width {
+		return s + strings.Repeat(" ", width-w)
+	}
+	return s
+}
+
+// padLeft right aligns s in width columns.
+func padLeft(width int, s string) string {
+	if w := displayWidth(s); w < width {
+		return strings.Repeat(" ", width-w) + s
+	}
+	return s
+}
+
+// truncateWidth cuts s to at most width columns, ending it with … if
+// anything was removed.
+func truncateWidth(width int, s string) string {
+	if displayWidth(s) <= width {
+		return s
+	}
+	w := 0
+	for i, r := range s {
+		if w+runeWidth(r)+1 > width {
+			if width <= 0 {
+				return ""
+			}
+			return s[:i] + "…"
+		}
+		w += runeWidth(r)
+	}
+	return s
+}
+
+// walk records the fields referenced by the template, as .key or
+// index . "key", and whether it calls rest.
+func (rt *recordTemplate) walk(n parse.Node) {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, sub := range n.Nodes {
+			rt.walk(sub)
+		}
+	case *parse.ActionNode:
+		rt.walk(n.Pipe)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			rt.walk(cmd)
+		}
+	case *parse.CommandNode:
+		if len(n.Args) == 3 {
+			fn, isIdent := n.Args[0].(*parse.IdentifierNode)
+			_, isDot := n.Args[1].(*parse.DotNode)
+			key, isString := n.Args[2].(*parse.StringNode)
+			if isIdent && fn.Ident == "index" && isDot && isString {
+				rt.used[key.Text] = true
+			}
+		}
+		for _, arg := range n.Args {
+			rt.walk(arg)
+		}
+	case *parse.IdentifierNode:
+		if n.Ident == "rest" {
+			rt.hasRest = true
+		}
+	case *parse.FieldNode:
+		rt.used[n.Ident[0]] = true
+	case *parse.IfNode:
+		rt.walkBranch(&n.BranchNode)
+	case *parse.RangeNode:
+		rt.walkBranch(&n.BranchNode)
+	case *parse.WithNode:
+		rt.walkBranch(&n.BranchNode)
+	case *parse.TemplateNode:
+		rt.walk(n.Pipe)
+	}
+}
+
+func (rt *recordTemplate) walkBranch(n *parse.BranchNode) {
+	rt.walk(n.Pipe)
+	rt.walk(n.List)
+	rt.walk(n.ElseList)
+}
+
+// formatTemplate renders rec with the -template. rest renders the
+// fields the template doesn't refer to as logfmt, in output order.
+func (c *converter) formatTemplate(rec map[string]interface{}, sortedFields []string, dropped int) (string, error) {
+	data := make(map[string]string, len(rec)+1)
+	for k, v := range rec {
+		if v != nil {
+			data[k] = convert.PlainValue(v)
+		} else {
+			data[k] = ""
+		}
+	}
+	if c.template.hasRest {
+		var rest []string
+		for _, k := range sortedFields {
+			if !c.template.used[k] {
+				rest = append(rest, k)
+			}
+		}
+		fields := c.logfmtFields(rec, rest)
+		if dropped > 0 {
+			fields = append(fields, field{key: fmt.Sprintf("…+%d", dropped), bare: true})
+		}
+		data[restKey] = joinFields(fields)
+	}
+
+	var b strings.Builder
+	if err := c.template.tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("-template: %s", err)
+	}
+	return b.String(), nil
+}
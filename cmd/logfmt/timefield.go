@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeLayouts are the string timestamp layouts recognized on input,
+// after any -time-input-format layouts. Times without a zone are UTC.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999Z0700",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999Z0700",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	time.RFC1123Z,
+	time.RFC1123,
+	time.UnixDate,
+}
+
+// lookupPath finds key in rec, either as a top level key or as a dotted
+// path through nested objects. It returns the map holding the value so
+// that callers can replace it.
+func lookupPath(rec map[string]interface{}, key string) (parent map[string]interface{}, leaf string, ok bool) {
+	if _, ok := rec[key]; ok {
+		return rec, key, true
+	}
+
+	parts := strings.Split(key, ".")
+	m := rec
+	for i, p := range parts {
+		v, ok := m[p]
+		if !ok {
+			return nil, "", false
+		}
+		if i == len(parts)-1 {
+			return m, p, true
+		}
+		m, ok = v.(map[string]interface{})
+		if !ok {
+			return nil, "", false
+		}
+	}
+	return nil, "", false
+}
+
+// parseTime interprets v as a timestamp: either a string in one of
+// timeLayouts or a number of seconds, milliseconds, microseconds or
+// nanoseconds since the Unix epoch (picked by magnitude).
+func parseTime(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case json.Number:
+		return parseEpoch(string(t))
+	case float64:
+		return epochTime(t), true
+	case string:
+		for _, layout := range timeLayouts {
+			if ts, err := time.Parse(layout, t); err == nil {
+				return ts, true
+			}
+		}
+		return parseEpoch(t)
+	}
+	return time.Time{}, false
+}
+
+func parseEpoch(s string) (time.Time, bool) {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return epochInt(i), true
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return time.Time{}, false
+	}
+	return epochTime(f), true
+}
+
+func epochInt(i int64) time.Time {
+	abs := i
+	if abs < 0 {
+		abs = -abs
+	}
+	switch {
+	case abs >= 1e17:
+		return time.Unix(0, i)
+	case abs >= 1e14:
+		return time.Unix(0, i*int64(time.Microsecond))
+	case abs >= 1e11:
+		return time.Unix(0, i*int64(time.Millisecond))
+	}
+	return time.Unix(i, 0)
+}
+
+func epochTime(f float64) time.Time {
+	abs := math.Abs(f)
+	switch {
+	case abs >= 1e17:
+		return time.Unix(0, int64(f))
+	case abs >= 1e14:
+		return time.Unix(0, int64(f*1e3))
+	case abs >= 1e11:
+		return time.Unix(0, int64(f*1e6))
+	}
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(frac*1e9))
+}
+
+// findTime returns the timestamp of rec from the first of the candidate
+// -time-field fields that is present and parses as a time, skipping a
+// present but unparseable one in favor of later candidates. parent and
+// key locate the field used. ok is false if no candidate parses, in
+// which case time based features leave the record alone.
+func findTime(rec map[string]interface{}, fields []string) (ts time.Time, parent map[string]interface{}, key string, ok bool) {
+	for _, f := range fields {
+		parent, key, ok := lookupPath(rec, f)
+		if !ok {
+			continue
+		}
+		if ts, ok := parseTime(parent[key]); ok {
+			return ts, parent, key, true
+		}
+	}
+	return time.Time{}, nil, "", false
+}
+
+// timeFormatter re-renders the -time-field of each record using the
+// -time-format layout and -time-zone, or with -time-relative or
+// -time-since as the offset from a base time: the first written
+// record's, a fixed anchor or, with sincePrev, the previous written
+// record's.
+type timeFormatter struct {
+	fields []string
+	layout string
+	// loc, if set, is the zone times are rendered in
+	loc *time.Location
+
+	// relative output depends on the records being seen in input
+	// order, so it is only used with -concurrency 1.
+	relative  bool
+	humanize  bool
+	sincePrev bool
+	base      time.Time
+	haveBase  bool
+	// pending is the time of the last record rendered, which becomes
+	// the base on commit.
+	pending     time.Time
+	havePending bool
+}
+
+func (t *timeFormatter) apply(rec map[string]interface{}) {
+	t.havePending = false
+	ts, parent, key, ok := findTime(rec, t.fields)
+	if !ok {
+		return
+	}
+	if !t.relative {
+		if t.loc != nil {
+			ts = ts.In(t.loc)
+		}
+		parent[key] = ts.Format(t.layout)
+		return
+	}
+	base := t.base
+	if !t.haveBase {
+		base = ts
+	}
+	t.pending, t.havePending = ts, true
+	d := ts.Sub(base)
+	if !t.humanize {
+		parent[key] = fmt.Sprintf("%+.3fs", d.Seconds())
+		return
+	}
+	s := humanizeDuration(d)
+	if d >= 0 {
+		s = "+" + s
+	}
+	parent[key] = s
+}
+
+// commit records that the record last passed to apply is written, so
+// that it sets the base for -time-relative and, with sincePrev, for
+// the next record. Records the filters drop are never committed.
+func (t *timeFormatter) commit() {
+	if !t.havePending {
+		return
+	}
+	if !t.haveBase || t.sincePrev {
+		t.base, t.haveBase = t.pending, true
+	}
+	t.havePending = false
+}
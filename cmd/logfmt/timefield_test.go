@@ -0,0 +1,153 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTimeFormatterNestedField(t *testing.T) {
+	tests := []struct {
+		name    string
+		fields  []string
+		flatten bool
+		in      string
+		want    string
+	}{
+		{
+			name:   "nested",
+			fields: []string{"meta.ts"},
+			in:     `{"msg":"x","meta":{"ts":"2024-03-10T12:00:00.5Z","id":1}}`,
+			want:   `{"msg":"x","meta":{"ts":"2024-03-10 07:00:00.500","id":1}}`,
+		},
+		{
+			name:    "flattened",
+			fields:  []string{"meta.ts"},
+			flatten: true,
+			in:      `{"msg":"x","meta":{"ts":"2024-03-10T12:00:00.5Z","id":1}}`,
+			want:    `{"msg":"x","meta.ts":"2024-03-10 07:00:00.500","meta.id":1}`,
+		},
+		{
+			name:   "dotted top level key wins",
+			fields: []string{"meta.ts"},
+			in:     `{"meta.ts":"2024-03-10T12:00:00Z","meta":{"ts":"2024-03-10T13:00:00Z"}}`,
+			want:   `{"meta.ts":"2024-03-10 07:00:00.000","meta":{"ts":"2024-03-10T13:00:00Z"}}`,
+		},
+		{
+			name:   "nested epoch millis",
+			fields: []string{"time", "meta.ts"},
+			in:     `{"meta":{"ts":1710072000000}}`,
+			want:   `{"meta":{"ts":"2024-03-10 07:00:00.000"}}`,
+		},
+		{
+			name:   "missing",
+			fields: []string{"meta.ts"},
+			in:     `{"meta":"2024-03-10T12:00:00Z"}`,
+			want:   `{"meta":"2024-03-10T12:00:00Z"}`,
+		},
+	}
+
+	loc := time.FixedZone("EST", -5*3600)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := decodeTestRecord(t, tt.in)
+			if tt.flatten {
+				var err error
+				f := &flattener{enabled: true}
+				if rec, err = f.apply(rec, &collider{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tf := &timeFormatter{fields: tt.fields, layout: "2006-01-02 15:04:05.000", loc: loc}
+			tf.apply(rec)
+			if want := decodeTestRecord(t, tt.want); !reflect.DeepEqual(rec, want) {
+				t.Errorf("got %v, want %v", rec, want)
+			}
+		})
+	}
+}
+
+func TestTimeFormatterRelativeNested(t *testing.T) {
+	tf := &timeFormatter{fields: []string{"meta.ts"}, relative: true}
+	var got []interface{}
+	for _, in := range []string{
+		`{"meta":{"ts":"2024-03-10T12:00:00Z"}}`,
+		`{"meta":{"ts":"2024-03-10T12:00:01.25Z"}}`,
+	} {
+		rec := decodeTestRecord(t, in)
+		tf.apply(rec)
+		tf.commit()
+		got = append(got, rec["meta"].(map[string]interface{})["ts"])
+	}
+	if want := []interface{}{"+0.000s", "+1.250s"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestTimeFieldAfterFlatten(t *testing.T) {
+	c := &converter{
+		flattener: &flattener{enabled: true},
+		times:     &timeFormatter{fields: []string{"meta.ts"}, layout: time.Kitchen, loc: time.UTC},
+		arrayMode: "value",
+	}
+	rec, ok, _, err := c.transformMatch(decodeTestRecord(t, `{"meta":{"ts":"2024-03-10T15:04:00Z"}}`), 0)
+	if err != nil || !ok {
+		t.Fatalf("transformMatch: ok=%t err=%v", ok, err)
+	}
+	if want := map[string]interface{}{"meta.ts": "3:04PM"}; !reflect.DeepEqual(rec, want) {
+		t.Errorf("got %v, want %v", rec, want)
+	}
+}
+
+func TestTimeBaseSkipsDroppedRecords(t *testing.T) {
+	input := []string{
+		`{"time":"2024-03-10T12:00:00Z","level":"debug"}`,
+		`{"time":"2024-03-10T12:00:01Z","level":"info"}`,
+		`{"time":"2024-03-10T12:00:03Z","level":"debug"}`,
+		`{"time":"2024-03-10T12:00:06Z","level":"info"}`,
+	}
+	tests := []struct {
+		name  string
+		times *timeFormatter
+		want  []string
+	}{
+		{
+			name:  "relative to first written",
+			times: &timeFormatter{fields: []string{"time"}, relative: true},
+			want:  []string{"+0.000s", "+5.000s"},
+		},
+		{
+			name:  "since prev written",
+			times: &timeFormatter{fields: []string{"time"}, relative: true, humanize: true, sincePrev: true},
+			want:  []string{"+0s", "+5s"},
+		},
+	}
+
+	filter, err := parseFilter("level=info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &converter{times: tt.times, filters: []filterExpr{filter}, arrayMode: "value", keyLess: func(a, b string) bool { return a < b }}
+			var got []string
+			for _, in := range input {
+				it := item{rec: decodeTestRecord(t, in)}
+				c.renderItem(&it)
+				if it.err != nil {
+					t.Fatal(it.err)
+				}
+				if it.ok {
+					got = append(got, it.line)
+				}
+			}
+			want := make([]string, len(tt.want))
+			for i, ts := range tt.want {
+				want[i] = "level=info time=" + ts
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
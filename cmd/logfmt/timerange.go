@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// timeRange keeps the records whose -time-field falls within -since
+// (inclusive) and -until (exclusive). Records without a parseable time
+// are dropped, since they can't be shown to be in the range. Each
+// record is checked on its own, so the input needn't be in time order
+// and the filter works the same on a stream or with -follow.
+type timeRange struct {
+	fields []string
+	since  time.Time
+	until  time.Time
+	// hasSince and hasUntil are false for an open end
+	hasSince bool
+	hasUntil bool
+}
+
+// newTimeRange parses the -since and -until bounds, returning nil if
+// neither is set. Relative bounds are resolved once, against the time
+// clock returns in loc (local time if nil). See parseTimeBound for the
+// forms they may take.
+func newTimeRange(fields []string, since, until string, clock func() time.Time, loc *time.Location) (*timeRange, error) {
+	if since == "" && until == "" {
+		return nil, nil
+	}
+	now := clock()
+	if loc != nil {
+		now = now.In(loc)
+	}
+	r := &timeRange{fields: fields}
+	var err error
+	if since != "" {
+		if r.since, err = parseTimeBound(since, now, now); err != nil {
+			return nil, fmt.Errorf("invalid -since %q: %s", since, err)
+		}
+		r.hasSince = true
+	}
+	if until != "" {
+		// a bare time of day is on the same day as -since
+		day := now
+		if r.hasSince {
+			day = r.since
+		}
+		if r.until, err = parseTimeBound(until, now, day); err != nil {
+			return nil, fmt.Errorf("invalid -until %q: %s", until, err)
+		}
+		r.hasUntil = true
+	}
+	if r.hasSince && r.hasUntil && !r.until.After(r.since) {
+		return nil, fmt.Errorf("-until %s is not after -since %s", r.until.Format(time.RFC3339Nano), r.since.Format(time.RFC3339Nano))
+	}
+	return r, nil
+}
+
+// timeOfDayLayouts are the layouts parseTimeBound accepts for a time
+// on the reference day.
+var timeOfDayLayouts = []string{
+	"15:04",
+	"15:04:05",
+	"15:04:05.999999999",
+}
+
+// parseTimeBound parses a -since or -until value: now, a duration
+// relative to now such as -15m or +1h, a time of day such as 10:30 on
+// the same day as day and in its zone, a date, or any timestamp
+// parseTime accepts.
+func parseTimeBound(s string, now, day time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "now" {
+		return now, nil
+	}
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		if d, err := time.ParseDuration(s); err == nil {
+			return now.Add(d), nil
+		}
+	}
+	for _, layout := range timeOfDayLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			y, m, d := day.Date()
+			return time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), day.Location()), nil
+		}
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	if t, ok := parseTime(s); ok {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("expected a timestamp, a time of day such as 10:30 or a duration such as -15m")
+}
+
+// match reports whether rec's time is within the range.
+func (r *timeRange) match(rec map[string]interface{}) bool {
+	ts, _, _, ok := findTime(rec, r.fields)
+	if !ok {
+		return false
+	}
+	if r.hasSince && ts.Before(r.since) {
+		return false
+	}
+	if r.hasUntil && !ts.Before(r.until) {
+		return false
+	}
+	return true
+}
+
+func (r *timeRange) String() string {
+	bound := func(ok bool, t time.Time) string {
+		if !ok {
+			return "open"
+		}
+		return t.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprintf("since %s until %s (fields=%s)", bound(r.hasSince, r.since), bound(r.hasUntil, r.until), strings.Join(r.fields, ","))
+}
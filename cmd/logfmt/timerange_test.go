@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeRange(t *testing.T) {
+	clock := func() time.Time { return time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name         string
+		since, until string
+		kept         map[string]bool
+	}{
+		{
+			name:  "relative since",
+			since: "-15m",
+			kept: map[string]bool{
+				"2024-03-10T11:44:59Z": false,
+				"2024-03-10T11:45:00Z": true,
+				"2024-03-10T12:30:00Z": true,
+			},
+		},
+		{
+			name:  "time of day on the clock's date",
+			since: "10:30",
+			until: "11:00",
+			kept: map[string]bool{
+				"2024-03-10T10:29:59Z": false,
+				"2024-03-10T10:30:00Z": true,
+				"2024-03-10T10:59:59Z": true,
+				"2024-03-10T11:00:00Z": false,
+				"2024-03-09T10:45:00Z": false,
+			},
+		},
+		{
+			name:  "until time of day follows since's date",
+			since: "2024-01-02",
+			until: "06:00",
+			kept: map[string]bool{
+				"2024-01-02T05:59:00Z": true,
+				"2024-01-02T06:00:00Z": false,
+			},
+		},
+		{
+			name:  "until now",
+			until: "now",
+			kept: map[string]bool{
+				"2024-03-10T11:59:59Z": true,
+				"2024-03-10T12:00:00Z": false,
+				"not a time":           false,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := newTimeRange([]string{"time"}, tt.since, tt.until, clock, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for ts, want := range tt.kept {
+				if got := r.match(map[string]interface{}{"time": ts}); got != want {
+					t.Errorf("%s: kept = %t, want %t", ts, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestTimeRangeZone(t *testing.T) {
+	clock := func() time.Time { return time.Date(2024, 3, 10, 2, 0, 0, 0, time.UTC) }
+	loc := time.FixedZone("UTC-5", -5*3600)
+
+	// 02:00 UTC is still March 9 at UTC-5
+	r, err := newTimeRange([]string{"time"}, "20:00", "", clock, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2024, 3, 10, 1, 0, 0, 0, time.UTC); !r.since.Equal(want) {
+		t.Errorf("since = %s, want %s", r.since, want)
+	}
+}
+
+func TestTimeRangeErrors(t *testing.T) {
+	clock := func() time.Time { return time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		since, until string
+	}{
+		{"yesterday", ""},
+		{"", "-5x"},
+		{"12:00", "11:00"},
+		{"now", "now"},
+	}
+	for _, tt := range tests {
+		if _, err := newTimeRange([]string{"time"}, tt.since, tt.until, clock, nil); err == nil {
+			t.Errorf("since %q until %q: no error", tt.since, tt.until)
+		}
+	}
+}
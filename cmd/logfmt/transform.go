@@ -0,0 +1,277 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/psanford/logfmt/convert"
+)
+
+// constField is a static field added to every record by -set.
+type constField struct {
+	key   string
+	value string
+}
+
+// foldField builds a synthetic field from a template referencing other
+// top level fields, e.g. endpoint='{method} {path}'.
+type foldField struct {
+	key      string
+	literals []string // len(literals) == len(refs)+1
+	refs     []string
+}
+
+func parseFold(spec string) (*foldField, error) {
+	idx := strings.Index(spec, "=")
+	if idx < 1 {
+		return nil, fmt.Errorf("invalid -fold %q, expected key=template", spec)
+	}
+	f := &foldField{key: spec[:idx]}
+
+	tmpl := spec[idx+1:]
+	for {
+		open := strings.IndexByte(tmpl, '{')
+		if open < 0 {
+			break
+		}
+		end := strings.IndexByte(tmpl[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("invalid -fold %q, unclosed '{'", spec)
+		}
+		f.literals = append(f.literals, tmpl[:open])
+		f.refs = append(f.refs, tmpl[open+1:open+end])
+		tmpl = tmpl[open+end+1:]
+	}
+	f.literals = append(f.literals, tmpl)
+
+	return f, nil
+}
+
+func (f *foldField) apply(rec map[string]interface{}, collide *collider) error {
+	var b strings.Builder
+	for i, ref := range f.refs {
+		b.WriteString(f.literals[i])
+		if v, ok := rec[ref]; ok && v != nil {
+			b.WriteString(convert.PlainValue(v))
+		}
+	}
+	b.WriteString(f.literals[len(f.literals)-1])
+	return collide.set(rec, f.key, b.String())
+}
+
+// parseJSONField decodes string fields holding an encoded JSON object.
+// With nest the decoded object replaces the string value, otherwise its
+// keys are merged into the record and the field is removed.
+func parseJSONField(rec map[string]interface{}, key string, nest bool, collide *collider) error {
+	s, ok := rec[key].(string)
+	if !ok {
+		return nil
+	}
+	trimmed := strings.TrimSpace(s)
+	if !strings.HasPrefix(trimmed, "{") {
+		return nil
+	}
+
+	inner, err := convert.DecodeRecord([]byte(trimmed))
+	if err != nil {
+		// not JSON after all; pass through untouched
+		return nil
+	}
+
+	if nest {
+		rec[key] = inner
+		return nil
+	}
+
+	delete(rec, key)
+	for k, v := range inner {
+		if err := collide.set(rec, k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flattener turns nested objects into dotted top level keys, e.g.
+// {"http":{"method":"GET"}} becomes http.method=GET. Fields listed in
+// rawJSON are instead re-encoded as compact JSON strings.
+type flattener struct {
+	enabled bool
+	rawJSON map[string]bool
+
+	// arrays also flattens arrays, keying elements by index (a.0.b).
+	arrays bool
+	// maxDepth, if positive, stops flattening after this many levels
+	// of nesting; deeper values are kept whole.
+	maxDepth int
+	// prefix is added to keys built from nested values, leaving top
+	// level keys as they are.
+	prefix string
+}
+
+func (f *flattener) apply(rec map[string]interface{}, collide *collider) (map[string]interface{}, error) {
+	out := make(map[string]interface{}, len(rec))
+	if err := f.flattenInto(out, collide, "", rec, 0); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (f *flattener) flattenInto(out map[string]interface{}, collide *collider, prefix string, m map[string]interface{}, depth int) error {
+	// visit keys in a stable order so collisions resolve deterministically
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if err := f.flattenValue(out, collide, prefix+k, m[k], depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flattenValue sets key to v in out, or to each of v's leaf values
+// under key if v is nested and may be flattened at depth.
+func (f *flattener) flattenValue(out map[string]interface{}, collide *collider, key string, v interface{}, depth int) error {
+	if f.rawJSON[key] {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("encode -raw-json field %q: %w", key, err)
+		}
+		v = string(b)
+	} else if f.enabled && (f.maxDepth <= 0 || depth < f.maxDepth) {
+		switch nested := v.(type) {
+		case map[string]interface{}:
+			if len(nested) > 0 {
+				return f.flattenInto(out, collide, key+".", nested, depth+1)
+			}
+		case []interface{}:
+			if f.arrays && len(nested) > 0 {
+				for i, elem := range nested {
+					if err := f.flattenValue(out, collide, key+"."+strconv.Itoa(i), elem, depth+1); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+		}
+	}
+	if depth > 0 {
+		key = f.prefix + key
+	}
+	return collide.set(out, key, v)
+}
+
+// numericKeysToArrays returns v with every object whose keys are
+// exactly the integers 0 to n-1, as written by some serializers for
+// lists, replaced by an array of its values in key order. Keys with
+// signs, leading zeros or gaps leave the object as is, so the result
+// doesn't depend on map iteration order.
+func numericKeysToArrays(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, elem := range t {
+			t[k] = numericKeysToArrays(elem)
+		}
+		if arr, ok := denseArray(t); ok {
+			return arr
+		}
+	case []interface{}:
+		for i, elem := range t {
+			t[i] = numericKeysToArrays(elem)
+		}
+	}
+	return v
+}
+
+func denseArray(m map[string]interface{}) ([]interface{}, bool) {
+	if len(m) == 0 {
+		return nil, false
+	}
+	arr := make([]interface{}, len(m))
+	for k, v := range m {
+		i, err := strconv.Atoi(k)
+		if err != nil || i < 0 || i >= len(m) || strconv.Itoa(i) != k {
+			return nil, false
+		}
+		arr[i] = v
+	}
+	return arr, true
+}
+
+// summarizeArrays replaces array values with their length (count) or a
+// "value:count" summary of their elements (counts), most frequent
+// first.
+func summarizeArrays(rec map[string]interface{}, mode string) {
+	for k, v := range rec {
+		arr, ok := v.([]interface{})
+		if !ok {
+			continue
+		}
+		if mode == "count" {
+			rec[k] = len(arr)
+			continue
+		}
+
+		counts := make(map[string]int)
+		var order []string
+		for _, elem := range arr {
+			s := "null"
+			if elem != nil {
+				s = convert.PlainValue(elem)
+			}
+			if counts[s] == 0 {
+				order = append(order, s)
+			}
+			counts[s]++
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			return counts[order[i]] > counts[order[j]]
+		})
+		parts := make([]string, len(order))
+		for i, s := range order {
+			parts[i] = s + ":" + strconv.Itoa(counts[s])
+		}
+		rec[k] = strings.Join(parts, " ")
+	}
+}
+
+// collapseWhitespace replaces each run of spaces and tabs (and, with
+// newlines, line breaks) in s with a single space.
+func collapseWhitespace(s string, newlines bool) string {
+	isSpace := func(r rune) bool {
+		switch r {
+		case ' ', '\t', '\v', '\f':
+			return true
+		case '\n', '\r':
+			return newlines
+		}
+		return false
+	}
+
+	if strings.IndexFunc(s, isSpace) < 0 {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	inRun := false
+	for _, r := range s {
+		if isSpace(r) {
+			if !inRun {
+				b.WriteByte(' ')
+			}
+			inRun = true
+			continue
+		}
+		inRun = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
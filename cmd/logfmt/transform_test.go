@@ -0,0 +1,232 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestFlattenArrays(t *testing.T) {
+	tests := []struct {
+		name string
+		f    flattener
+		in   string
+		want string
+	}{
+		{
+			name: "objects in an array",
+			f:    flattener{enabled: true, arrays: true},
+			in:   `{"a":[{"b":1},{"b":2}]}`,
+			want: `{"a.0.b":1,"a.1.b":2}`,
+		},
+		{
+			name: "nested arrays",
+			f:    flattener{enabled: true, arrays: true},
+			in:   `{"m":[[1,2],[3,[4,5]]],"x":"y"}`,
+			want: `{"m.0.0":1,"m.0.1":2,"m.1.0":3,"m.1.1.0":4,"m.1.1.1":5,"x":"y"}`,
+		},
+		{
+			name: "arrays in objects in arrays",
+			f:    flattener{enabled: true, arrays: true},
+			in:   `{"r":[{"tags":["a","b"]},{"tags":[]}]}`,
+			want: `{"r.0.tags.0":"a","r.0.tags.1":"b","r.1.tags":[]}`,
+		},
+		{
+			name: "arrays kept without flatten-arrays",
+			f:    flattener{enabled: true},
+			in:   `{"m":[[1,2],{"b":3}],"o":{"p":[1]}}`,
+			want: `{"m":[[1,2],{"b":3}],"o.p":[1]}`,
+		},
+		{
+			name: "max depth",
+			f:    flattener{enabled: true, arrays: true, maxDepth: 2},
+			in:   `{"m":[[1,[2]],3]}`,
+			want: `{"m.0.0":1,"m.0.1":[2],"m.1":3}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.f.apply(decodeTestRecord(t, tt.in), &collider{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := decodeTestRecord(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestNumericKeysToArrays(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"dense", `{"l":{"0":"a","1":"b","2":"c"}}`, `{"l":["a","b","c"]}`},
+		{"out of order", `{"l":{"1":"b","0":"a"}}`, `{"l":["a","b"]}`},
+		{"gap", `{"l":{"0":"a","2":"c"}}`, `{"l":{"0":"a","2":"c"}}`},
+		{"not from zero", `{"l":{"1":"a","2":"b"}}`, `{"l":{"1":"a","2":"b"}}`},
+		{"leading zero", `{"l":{"0":"a","01":"b"}}`, `{"l":{"0":"a","01":"b"}}`},
+		{"sign", `{"l":{"0":"a","+1":"b"}}`, `{"l":{"0":"a","+1":"b"}}`},
+		{"mixed keys", `{"l":{"0":"a","x":"b"}}`, `{"l":{"0":"a","x":"b"}}`},
+		{"empty", `{"l":{}}`, `{"l":{}}`},
+		{"nested", `{"l":{"0":{"0":1,"1":2},"1":[{"0":3}]}}`, `{"l":[[1,2],[[3]]]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := decodeTestRecord(t, tt.in)
+			for k, v := range rec {
+				rec[k] = numericKeysToArrays(v)
+			}
+			if want := decodeTestRecord(t, tt.want); !reflect.DeepEqual(rec, want) {
+				t.Errorf("got %v, want %v", rec, want)
+			}
+		})
+	}
+}
+
+func TestNumericKeyOrder(t *testing.T) {
+	const in = `{"l":{"0":"a","1":"b","2":"c","3":"d","4":"e","5":"f","6":"g","7":"h","8":"i","9":"j","10":"k"}}`
+
+	tests := []struct {
+		name    string
+		natural bool
+		arrays  bool
+		want    []string
+	}{
+		{
+			name: "lexical",
+			want: []string{"l.0", "l.1", "l.10", "l.2", "l.3", "l.4", "l.5", "l.6", "l.7", "l.8", "l.9"},
+		},
+		{
+			name:    "natural",
+			natural: true,
+			want:    []string{"l.0", "l.1", "l.2", "l.3", "l.4", "l.5", "l.6", "l.7", "l.8", "l.9", "l.10"},
+		},
+		{
+			// flattened array indexes are the same keys as the
+			// object's, so they sort the same way
+			name:    "as array, natural",
+			natural: true,
+			arrays:  true,
+			want:    []string{"l.0", "l.1", "l.2", "l.3", "l.4", "l.5", "l.6", "l.7", "l.8", "l.9", "l.10"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := decodeTestRecord(t, in)
+			if tt.arrays {
+				rec["l"] = numericKeysToArrays(rec["l"])
+			}
+			f := &flattener{enabled: true, arrays: true}
+			flat, err := f.apply(rec, &collider{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			order := newFieldOrder(nil, nil)
+			order.Natural = tt.natural
+			if got := sortKeys(flat, order.Less); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlattenPrefix(t *testing.T) {
+	tests := []struct {
+		name string
+		f    flattener
+		in   string
+		want string
+	}{
+		{
+			name: "mixed depths",
+			f:    flattener{enabled: true, prefix: "ctx."},
+			in:   `{"msg":"hi","http":{"method":"GET","req":{"id":7}},"tags":["a"]}`,
+			want: `{"msg":"hi","ctx.http.method":"GET","ctx.http.req.id":7,"tags":["a"]}`,
+		},
+		{
+			name: "arrays",
+			f:    flattener{enabled: true, arrays: true, prefix: "ctx."},
+			in:   `{"msg":"hi","tags":["a",{"k":"v"}]}`,
+			want: `{"msg":"hi","ctx.tags.0":"a","ctx.tags.1.k":"v"}`,
+		},
+		{
+			name: "max depth keeps the rest whole",
+			f:    flattener{enabled: true, maxDepth: 1, prefix: "ctx."},
+			in:   `{"level":"info","a":{"b":{"c":1},"d":2}}`,
+			want: `{"level":"info","ctx.a.b":{"c":1},"ctx.a.d":2}`,
+		},
+		{
+			name: "empty object stays top level",
+			f:    flattener{enabled: true, prefix: "ctx."},
+			in:   `{"meta":{},"n":1}`,
+			want: `{"meta":{},"n":1}`,
+		},
+		{
+			name: "no prefix",
+			f:    flattener{enabled: true},
+			in:   `{"msg":"hi","http":{"method":"GET"}}`,
+			want: `{"msg":"hi","http.method":"GET"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.f.apply(decodeTestRecord(t, tt.in), &collider{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := decodeTestRecord(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestKeyPrefix(t *testing.T) {
+	tests := []struct {
+		name string
+		c    *converter
+		file int
+		want []string
+	}{
+		{
+			name: "prefix",
+			c:    &converter{keyPrefix: "app_"},
+			want: []string{"app_level", "app_msg"},
+		},
+		{
+			name: "per file",
+			c:    &converter{keyPrefix: "{file}.", keyPrefixes: []string{"a.log.", "b.log."}},
+			file: 1,
+			want: []string{"b.log.level", "b.log.msg"},
+		},
+		{
+			name: "hash field is prefixed too",
+			c:    &converter{keyPrefix: "app_", hashField: "hash"},
+			want: []string{"app_hash", "app_level", "app_msg"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.c.arrayMode = "value"
+			rec, ok, _, err := tt.c.transformMatch(decodeTestRecord(t, `{"msg":"hi","level":"info"}`), tt.file)
+			if err != nil || !ok {
+				t.Fatalf("transformMatch: ok=%t err=%v", ok, err)
+			}
+			var got []string
+			for k := range rec {
+				got = append(got, k)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got keys %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
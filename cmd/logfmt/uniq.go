@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/psanford/logfmt/convert"
+)
+
+// uniqFilter drops records whose -uniq-by fields repeat an earlier
+// combination. Every distinct combination seen is kept in memory for
+// the life of the run.
+type uniqFilter struct {
+	fields   []string
+	keepLast bool
+
+	seen map[string]int
+
+	// with keepLast, every item is buffered until EOF since a later
+	// record may replace an earlier one.
+	buffered []item
+}
+
+func newUniqFilter(fields []string, keepLast bool) *uniqFilter {
+	return &uniqFilter{
+		fields:   fields,
+		keepLast: keepLast,
+		seen:     make(map[string]int),
+	}
+}
+
+// key builds the dedup key for rec from the configured fields.
+func (u *uniqFilter) key(rec map[string]interface{}) string {
+	var b strings.Builder
+	for _, f := range u.fields {
+		v, ok := rec[f]
+		if ok {
+			b.WriteByte('=')
+			b.WriteString(convert.PlainValue(v))
+		}
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// add returns the items that may be written now.
+func (u *uniqFilter) add(it item) []item {
+	if u.keepLast {
+		if !it.synthetic {
+			if prev, ok := u.seen[it.uniqKey]; ok {
+				u.buffered[prev].ok = false
+			}
+			u.seen[it.uniqKey] = len(u.buffered)
+		}
+		u.buffered = append(u.buffered, it)
+		return nil
+	}
+
+	if it.synthetic {
+		return []item{it}
+	}
+	if _, ok := u.seen[it.uniqKey]; ok {
+		return nil
+	}
+	u.seen[it.uniqKey] = 0
+	return []item{it}
+}
+
+// finish returns any items held back until EOF.
+func (u *uniqFilter) finish() []item {
+	out := u.buffered
+	u.buffered = nil
+	return out
+}
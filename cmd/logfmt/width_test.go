@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestDisplayWidth(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+	}{
+		{"", 0},
+		{"abc", 3},
+		{"日本語", 6},
+		{"ｈｉ", 4},
+		{"한글", 4},
+		{"é", 1},
+		{"a​b", 2},
+		{"🌟x", 3},
+		{"\x1b", 0},
+		{"\xff", 0},
+	}
+	for _, tt := range tests {
+		if got := displayWidth(tt.s); got != tt.want {
+			t.Errorf("displayWidth(%q) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+}
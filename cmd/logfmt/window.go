@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// aggSpec is one -agg aggregate: count, or op:field for sum, avg, min
+// or max of a numeric field.
+type aggSpec struct {
+	op    string
+	field string
+}
+
+func (a aggSpec) key() string {
+	if a.field == "" {
+		return a.op
+	}
+	return a.op + "_" + a.field
+}
+
+func parseAggs(spec string) ([]aggSpec, error) {
+	var aggs []aggSpec
+	for _, s := range splitList(spec) {
+		op, field := s, ""
+		if i := strings.IndexByte(s, ':'); i >= 0 {
+			op, field = s[:i], s[i+1:]
+		}
+		switch op {
+		case "count":
+		case "sum", "avg", "min", "max":
+			if field == "" {
+				return nil, fmt.Errorf("-agg %s needs a field, e.g. %s:latency", op, op)
+			}
+		default:
+			return nil, fmt.Errorf("unknown -agg %q (expected count, sum, avg, min or max)", op)
+		}
+		aggs = append(aggs, aggSpec{op: op, field: field})
+	}
+	if len(aggs) == 0 {
+		return nil, fmt.Errorf("-agg is empty")
+	}
+	return aggs, nil
+}
+
+// windowAgg folds records into fixed time windows by their -time-field
+// and renders one summary record per window. Windows are aligned to
+// multiples of size and a window is flushed once a record from a later
+// window arrives, so the input must be roughly in time order: records
+// from a window already flushed are dropped with a warning, as are
+// records without a parseable time.
+type windowAgg struct {
+	size       time.Duration
+	timeFields []string
+	layout     string
+	loc        *time.Location
+	aggs       []aggSpec
+	aggFields  []string
+
+	active bool
+	start  time.Time
+	count  int
+	// per field: number of numeric values seen and their sum, min
+	// and max
+	n        map[string]int
+	sum      map[string]float64
+	min, max map[string]float64
+}
+
+// add folds rec into the current window, returning the summary of the
+// previous window if rec starts a new one.
+func (w *windowAgg) add(rec map[string]interface{}) map[string]interface{} {
+	ts, _, _, ok := findTime(rec, w.timeFields)
+	if !ok {
+		return nil
+	}
+	start := ts.Truncate(w.size)
+
+	var done map[string]interface{}
+	if w.active && start.Before(w.start) {
+		warnf("dropping record at %s from a window already written", ts.Format(time.RFC3339Nano))
+		return nil
+	}
+	if !w.active || start.After(w.start) {
+		done = w.flush()
+		w.reset(start)
+	}
+
+	w.count++
+	for _, field := range w.fields() {
+		f, ok := numericValue(rec[field])
+		if !ok {
+			continue
+		}
+		if w.n[field] == 0 || f < w.min[field] {
+			w.min[field] = f
+		}
+		if w.n[field] == 0 || f > w.max[field] {
+			w.max[field] = f
+		}
+		w.n[field]++
+		w.sum[field] += f
+	}
+	return done
+}
+
+// fields returns the distinct fields named by the aggregates.
+func (w *windowAgg) fields() []string {
+	if w.aggFields == nil {
+		seen := make(map[string]bool)
+		w.aggFields = []string{}
+		for _, a := range w.aggs {
+			if a.field != "" && !seen[a.field] {
+				seen[a.field] = true
+				w.aggFields = append(w.aggFields, a.field)
+			}
+		}
+	}
+	return w.aggFields
+}
+
+func (w *windowAgg) reset(start time.Time) {
+	w.active = true
+	w.start = start
+	w.count = 0
+	w.n = make(map[string]int)
+	w.sum = make(map[string]float64)
+	w.min = make(map[string]float64)
+	w.max = make(map[string]float64)
+}
+
+// flush returns the summary of the current window, if any, and ends it.
+func (w *windowAgg) flush() map[string]interface{} {
+	if !w.active {
+		return nil
+	}
+	w.active = false
+
+	start := w.start
+	if w.loc != nil {
+		start = start.In(w.loc)
+	}
+	summary := map[string]interface{}{
+		"time": start.Format(w.layout),
+	}
+	for _, a := range w.aggs {
+		if a.op == "count" {
+			summary[a.key()] = w.count
+			continue
+		}
+		n := w.n[a.field]
+		if n == 0 {
+			continue
+		}
+		switch a.op {
+		case "sum":
+			summary[a.key()] = floatNumber(w.sum[a.field])
+		case "avg":
+			summary[a.key()] = w.sum[a.field] / float64(n)
+		case "min":
+			summary[a.key()] = floatNumber(w.min[a.field])
+		case "max":
+			summary[a.key()] = floatNumber(w.max[a.field])
+		}
+	}
+	return summary
+}
+
+// numericValue returns v as a float if it is a number or a string
+// holding one.
+func numericValue(v interface{}) (float64, bool) {
+	var s string
+	switch t := v.(type) {
+	case json.Number:
+		s = string(t)
+	case string:
+		s = t
+	case float64:
+		return t, true
+	case float32:
+		return float64(t), true
+	case int:
+		return float64(t), true
+	case int8:
+		return float64(t), true
+	case int16:
+		return float64(t), true
+	case int32:
+		return float64(t), true
+	case int64:
+		return float64(t), true
+	case uint:
+		return float64(t), true
+	case uint8:
+		return float64(t), true
+	case uint16:
+		return float64(t), true
+	case uint32:
+		return float64(t), true
+	case uint64:
+		return float64(t), true
+	default:
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return f, err == nil
+}
+
+// floatNumber renders f without trailing zeros, so integral sums stay
+// integers.
+func floatNumber(f float64) json.Number {
+	return json.Number(strconv.FormatFloat(f, 'f', -1, 64))
+}
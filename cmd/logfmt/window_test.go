@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWindowAgg(t *testing.T) {
+	tests := []struct {
+		name  string
+		aggs  string
+		input []string
+		want  []string
+	}{
+		{
+			name:  "no records",
+			aggs:  "count",
+			input: nil,
+			want:  nil,
+		},
+		{
+			name: "count per window",
+			aggs: "count",
+			input: []string{
+				`{"time":"2024-03-10T12:00:01Z"}`,
+				`{"time":"2024-03-10T12:00:09Z"}`,
+				`{"time":"2024-03-10T12:00:10Z"}`,
+			},
+			want: []string{
+				`{"time":"12:00:00","count":2}`,
+				`{"time":"12:00:10","count":1}`,
+			},
+		},
+		{
+			name: "empty windows are skipped",
+			aggs: "count",
+			input: []string{
+				`{"time":"2024-03-10T12:00:01Z"}`,
+				`{"time":"2024-03-10T12:00:35Z"}`,
+			},
+			want: []string{
+				`{"time":"12:00:00","count":1}`,
+				`{"time":"12:00:30","count":1}`,
+			},
+		},
+		{
+			name: "numeric aggregates",
+			aggs: "count,sum:ms,avg:ms,min:ms,max:ms",
+			input: []string{
+				`{"time":"2024-03-10T12:00:01Z","ms":10}`,
+				`{"time":"2024-03-10T12:00:02Z","ms":"2.5"}`,
+				`{"time":"2024-03-10T12:00:03Z","ms":"slow"}`,
+				`{"time":"2024-03-10T12:00:04Z"}`,
+			},
+			want: []string{
+				`{"time":"12:00:00","count":4,"sum_ms":12.5,"avg_ms":6.25,"min_ms":2.5,"max_ms":10}`,
+			},
+		},
+		{
+			name: "window without numeric values",
+			aggs: "count,avg:ms",
+			input: []string{
+				`{"time":"2024-03-10T12:00:01Z","ms":"n/a"}`,
+			},
+			want: []string{
+				`{"time":"12:00:00","count":1}`,
+			},
+		},
+		{
+			name: "late and untimed records are dropped",
+			aggs: "count",
+			input: []string{
+				`{"time":"2024-03-10T12:00:11Z"}`,
+				`{"time":"2024-03-10T12:00:01Z"}`,
+				`{"msg":"no time"}`,
+				`{"time":"2024-03-10T12:00:12Z"}`,
+			},
+			want: []string{
+				`{"time":"12:00:10","count":2}`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aggs, err := parseAggs(tt.aggs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := &windowAgg{size: 10 * time.Second, timeFields: []string{"time"}, layout: "15:04:05", aggs: aggs}
+			var got []map[string]interface{}
+			for _, in := range tt.input {
+				if rec := w.add(decodeTestRecord(t, in)); rec != nil {
+					got = append(got, rec)
+				}
+			}
+			if rec := w.flush(); rec != nil {
+				got = append(got, rec)
+			}
+			if rec := w.flush(); rec != nil {
+				t.Errorf("second flush returned %v", rec)
+			}
+
+			var want []map[string]interface{}
+			for _, s := range tt.want {
+				want = append(want, decodeTestRecord(t, s))
+			}
+			if len(got) != len(want) {
+				t.Fatalf("got %d windows %v, want %d", len(got), got, len(want))
+			}
+			for i := range got {
+				if !reflect.DeepEqual(normalizeNumbers(got[i]), want[i]) {
+					t.Errorf("window %d: got %v, want %v", i, got[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseAggsErrors(t *testing.T) {
+	for _, spec := range []string{"", "sum", "median:ms", "count,avg"} {
+		if _, err := parseAggs(spec); err == nil {
+			t.Errorf("parseAggs(%q): no error", spec)
+		}
+	}
+}
+
+// normalizeNumbers returns rec with its numbers as json.Number, as
+// decodeTestRecord has them.
+func normalizeNumbers(rec map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(rec))
+	for k, v := range rec {
+		switch n := v.(type) {
+		case int:
+			v = json.Number(fmt.Sprint(n))
+		case float64:
+			v = floatNumber(n)
+		}
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// wrapIndent prefixes continuation lines of a wrapped record.
+const wrapIndent = "    "
+
+// wrapFields breaks a record into lines of at most width columns,
+// only ever breaking between fields. A field wider than width is put
+// on a line of its own rather than split.
+func wrapFields(fields []field, width int) []string {
+	var lines []string
+	var b strings.Builder
+	col := 0
+	for _, f := range fields {
+		pair := f.pair()
+		w := f.width()
+		switch {
+		case col == 0:
+			if len(lines) > 0 {
+				b.WriteString(wrapIndent)
+				col = len(wrapIndent)
+			}
+		case col+1+w > width:
+			lines = append(lines, b.String())
+			b.Reset()
+			b.WriteString(wrapIndent)
+			col = len(wrapIndent)
+		default:
+			b.WriteByte(' ')
+			col++
+		}
+		b.WriteString(pair)
+		col += w
+	}
+	return append(lines, b.String())
+}
+
+// expandFields renders each field as a line of its own. With padKeys
+// keys are padded to the widest key so that the = signs line up.
+func expandFields(fields []field, padKeys bool) []string {
+	width := 0
+	if padKeys {
+		for _, f := range fields {
+			if w := displayWidth(f.key); !f.bare && w > width {
+				width = w
+			}
+		}
+	}
+
+	lines := make([]string, len(fields))
+	for i, f := range fields {
+		if f.bare || !padKeys {
+			lines[i] = f.pair()
+			continue
+		}
+		lines[i] = paint(f.keyColor, f.key) + strings.Repeat(" ", width-displayWidth(f.key)) + "=" + paint(f.valueColor, f.value)
+	}
+	return lines
+}
+
+// isTerminal reports whether f is an interactive terminal. Other
+// character devices such as /dev/null are not.
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// terminalWidth returns the terminal width from $COLUMNS or else the
+// size of the terminal on f, defaulting to 80.
+func terminalWidth(f *os.File) int {
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	if n, _, err := term.GetSize(int(f.Fd())); err == nil && n > 0 {
+		return n
+	}
+	return 80
+}
+
+// parseWrap resolves the -wrap flag to a width, or 0 to disable
+// wrapping. "auto" only wraps when stdout is a terminal.
+func parseWrap(s string) (int, error) {
+	switch s {
+	case "", "0":
+		return 0, nil
+	case "auto":
+		if !isTerminal(os.Stdout) {
+			return 0, nil
+		}
+		return terminalWidth(os.Stdout), nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, errors.New("expected a width or auto")
+	}
+	return n, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestExpandFieldsPadKeys(t *testing.T) {
+	fields := []field{
+		{key: "time", value: "12:00"},
+		{key: "message", value: "hi"},
+		{key: "marker", bare: true},
+		{key: "名前", value: "x"},
+	}
+
+	tests := []struct {
+		name    string
+		padKeys bool
+		want    []string
+	}{
+		{
+			name: "unpadded",
+			want: []string{"time=12:00", "message=hi", "marker", "名前=x"},
+		},
+		{
+			name:    "padded",
+			padKeys: true,
+			want:    []string{"time   =12:00", "message=hi", "marker", "名前   =x"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expandFields(fields, tt.padKeys); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandPadKeysPerRecord(t *testing.T) {
+	var buf bytes.Buffer
+	o := newOutput(&buf, 4096)
+	o.expand, o.padKeys = true, true
+	o.writeRecord("", "", []field{{key: "a", value: "1"}, {key: "longer", value: "2"}})
+	o.writeRecord("", "", []field{{key: "a", value: "3"}, {key: "bb", value: "4"}})
+	o.close()
+
+	want := "a     =1\nlonger=2\n\na =3\nbb=4\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestIsTerminalDevNull(t *testing.T) {
+	f, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer f.Close()
+	if isTerminal(f) {
+		t.Errorf("%s reported as a terminal", os.DevNull)
+	}
+}
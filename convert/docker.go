@@ -0,0 +1,103 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// dockerReader unwraps Docker json-file log entries such as
+//
+//	{"log":"{\"level\":\"info\"}\n","stream":"stdout","time":"..."}
+//
+// The log string is decoded as the record if it holds a JSON object,
+// and is otherwise kept as msg. The other envelope fields are added
+// to the record, prefixed with docker_ if the record already has a
+// field of the same name. Docker splits long lines across entries
+// whose log doesn't end in a newline; these are joined again. Records
+// without a log string are passed through as is.
+type dockerReader struct {
+	r    RecordReader
+	line int
+
+	// pending is a record read while looking for the end of a split
+	// line, returned by the next call.
+	pending     map[string]interface{}
+	pendingLine int
+}
+
+func (d *dockerReader) Next() (map[string]interface{}, error) {
+	if d.pending != nil {
+		rec := d.pending
+		d.pending = nil
+		d.line = d.pendingLine
+		return rec, nil
+	}
+
+	var partial strings.Builder
+	var envelope map[string]interface{}
+	for {
+		rec, err := d.r.Next()
+		if err == io.EOF && envelope != nil {
+			// input ended within a split line
+			return unwrapDocker(envelope, partial.String()), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		s, ok := rec["log"].(string)
+		if !ok {
+			if envelope != nil {
+				// shouldn't happen; don't lose the partial line
+				d.pending, d.pendingLine = rec, d.r.Line()
+				return unwrapDocker(envelope, partial.String()), nil
+			}
+			d.line = d.r.Line()
+			return rec, nil
+		}
+		if envelope == nil {
+			// a split line takes the envelope of its first part
+			envelope = rec
+			d.line = d.r.Line()
+		}
+		partial.WriteString(s)
+		if strings.HasSuffix(s, "\n") {
+			return unwrapDocker(envelope, partial.String()), nil
+		}
+	}
+}
+
+func (d *dockerReader) Line() int {
+	return d.line
+}
+
+// unwrapDocker builds the record for a Docker log entry whose complete
+// log line is text.
+func unwrapDocker(envelope map[string]interface{}, text string) map[string]interface{} {
+	text = strings.TrimSuffix(strings.TrimSuffix(text, "\n"), "\r")
+
+	var rec map[string]interface{}
+	trimmed := strings.TrimSpace(text)
+	if strings.HasPrefix(trimmed, "{") {
+		dec := json.NewDecoder(bytes.NewReader([]byte(trimmed)))
+		dec.UseNumber()
+		if err := dec.Decode(&rec); err != nil || dec.More() {
+			rec = nil
+		}
+	}
+	if rec == nil {
+		rec = map[string]interface{}{"msg": text}
+	}
+
+	for k, v := range envelope {
+		if k == "log" {
+			continue
+		}
+		if _, exists := rec[k]; exists {
+			k = "docker_" + k
+		}
+		rec[k] = v
+	}
+	return rec
+}
@@ -0,0 +1,21 @@
+package convert
+
+import "io"
+
+// An Encoder writes records to an output stream as logfmt lines.
+type Encoder struct {
+	w    io.Writer
+	opts Options
+}
+
+// NewEncoder returns an Encoder writing to w, formatting records as
+// FormatRecord does with opts.
+func NewEncoder(w io.Writer, opts Options) *Encoder {
+	return &Encoder{w: w, opts: opts}
+}
+
+// Encode writes rec as a single logfmt line followed by a newline.
+func (e *Encoder) Encode(rec map[string]interface{}) error {
+	_, err := io.WriteString(e.w, FormatRecord(rec, e.opts)+"\n")
+	return err
+}
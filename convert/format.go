@@ -0,0 +1,482 @@
+// Copyright Peter Sanford 2021
+// Parts of logfmt are derived from https://github.com/inconshreveable/log15 and copyright 2014 Alan Shreve
+
+// Package convert converts JSON log records to logfmt. It holds the
+// decoding and formatting used by the logfmt command, for use from
+// other programs.
+package convert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// FormatKey makes key safe to use unquoted on the left of a logfmt
+// pair, with the default Options.
+func FormatKey(key string) string {
+	return Options{}.FormatKey(key)
+}
+
+// FormatKey makes key safe to use unquoted on the left of a logfmt
+// pair. Keys can't be quoted, so characters that would otherwise end
+// the key or start the value are replaced with '_'.
+func (o Options) FormatKey(key string) string {
+	q := o.quote()
+	if isPlain(key, q) {
+		return key
+	}
+	invalid := func(r rune) bool {
+		return r <= ' ' || r == '=' || r == rune(q)
+	}
+	if strings.IndexFunc(key, invalid) < 0 {
+		return key
+	}
+	return strings.Map(func(r rune) rune {
+		if invalid(r) {
+			return '_'
+		}
+		return r
+	}, key)
+}
+
+// A ValueFormatter renders the value of the field key. It returns false
+// to decline, in which case the next formatter (or the default
+// formatting) is used. The returned string is written as is, so it must
+// already be escaped for logfmt.
+type ValueFormatter func(key string, v interface{}) (string, bool)
+
+var valueFormatters []ValueFormatter
+
+// RegisterValueFormatter adds f to the formatters consulted by
+// FormatValue. Formatters are tried in the order they were registered
+// and the first one to return true wins. Registration is not safe for
+// concurrent use and should happen before any records are formatted.
+func RegisterValueFormatter(f ValueFormatter) {
+	valueFormatters = append(valueFormatters, f)
+}
+
+// FormatValue formats the value of field key for logfmt output with
+// the default Options.
+func FormatValue(key string, value interface{}) string {
+	return Options{}.FormatValue(key, value)
+}
+
+// FormatValue formats the value of field key for logfmt output,
+// consulting any registered ValueFormatters before the default
+// formatting.
+func (o Options) FormatValue(key string, value interface{}) string {
+	for _, f := range valueFormatters {
+		if s, ok := f(key, value); ok {
+			return s
+		}
+	}
+	return o.formatLogfmtValue(value)
+}
+
+// Options controls how keys, values and records are formatted. The
+// zero value formats as the logfmt command does by default. Options
+// are passed by value and never modified, so one may be shared by
+// goroutines formatting concurrently.
+type Options struct {
+	// KeyLess reports whether key a is written before key b. It must
+	// define a strict weak ordering, as for sort.Slice. If nil, time
+	// and msg come first and other keys follow bytewise, like the
+	// command's default -order; see KeyOrder.
+	KeyLess func(a, b string) bool
+
+	// QuoteChar surrounds quoted values and is escaped with a
+	// backslash inside them. It must be a printable ASCII character
+	// other than space, = and \. If zero, " is used.
+	QuoteChar byte
+
+	// FloatFormat and FloatPrecision are the fmt and prec arguments
+	// to strconv.FormatFloat for float values, so 'f' and -1 write
+	// the fewest digits that parse back to the same value. If
+	// FloatFormat is zero, floats are written with 3 decimal places.
+	// json.Number values are written as they appeared in the input
+	// unless NumberPrecision is set.
+	FloatFormat    byte
+	FloatPrecision int
+	// NumberPrecision also formats json.Number values with a
+	// fraction or exponent as floats. Integers are still written as
+	// they appeared.
+	NumberPrecision bool
+
+	// InvalidUTF8 is how values containing bytes that aren't valid
+	// UTF-8 are written.
+	InvalidUTF8 InvalidUTF8
+
+	// Now is the clock for anything relative to the current time,
+	// such as the command's -since -15m. If nil, time.Now is used.
+	Now func() time.Time
+}
+
+// CurrentTime returns the time from Now, or time.Now if Now is nil.
+func (o Options) CurrentTime() time.Time {
+	if o.Now == nil {
+		return time.Now()
+	}
+	return o.Now()
+}
+
+// quote returns the quote character, defaulting to ".
+func (o Options) quote() byte {
+	if o.QuoteChar == 0 {
+		return '"'
+	}
+	return o.QuoteChar
+}
+
+// formatFloat formats f, which was a float of bitSize bits.
+func (o Options) formatFloat(f float64, bitSize int) string {
+	if o.FloatFormat == 0 {
+		return strconv.FormatFloat(f, defaultFloatFormat, defaultFloatPrecision, bitSize)
+	}
+	return strconv.FormatFloat(f, o.FloatFormat, o.FloatPrecision, bitSize)
+}
+
+// formatNumber formats n as a float if NumberPrecision applies to it.
+func (o Options) formatNumber(n json.Number) (string, bool) {
+	if !o.NumberPrecision || !strings.ContainsAny(string(n), ".eE") {
+		return "", false
+	}
+	f, err := strconv.ParseFloat(string(n), 64)
+	if err != nil {
+		return "", false
+	}
+	return o.formatFloat(f, 64), true
+}
+
+// FormatRecord renders rec as a single logfmt line, with values
+// formatted by FormatValue.
+func FormatRecord(rec map[string]interface{}, opts Options) string {
+	less := opts.KeyLess
+	if less == nil {
+		less = defaultKeyOrder.Less
+	}
+	keys := make([]string, 0, len(rec))
+	for k := range rec {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return less(keys[i], keys[j]) })
+
+	var b strings.Builder
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(opts.FormatKey(k))
+		b.WriteByte('=')
+		b.WriteString(opts.FormatValue(k, rec[k]))
+	}
+	return b.String()
+}
+
+// ConvertRecord renders rec as a logfmt line in the default key order.
+func ConvertRecord(rec map[string]interface{}) string {
+	return FormatRecord(rec, Options{})
+}
+
+// formatLogfmtValue formats a value for serialization
+func (o Options) formatLogfmtValue(value interface{}) string {
+	if value == nil {
+		return "nil"
+	}
+
+	// the types produced by decoding JSON come first: none of them
+	// need formatShared, which boxes a json.Number's String result
+	// into a new interface for every value.
+	switch v := value.(type) {
+	case string:
+		return o.EscapeString(v)
+	case json.Number:
+		if s, ok := o.formatNumber(v); ok {
+			return s
+		}
+		return o.EscapeString(string(v))
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return o.formatFloat(v, 64)
+	case []interface{}:
+		return o.EscapeString(arrayText(v))
+	case time.Time:
+		// Performance optimization: No need for escaping since the provided
+		// timeFormat doesn't have any escape characters, and escaping is
+		// expensive.
+		return v.Format(timeFormat)
+	}
+
+	value = formatShared(value)
+	switch v := value.(type) {
+	case bool:
+		return strconv.FormatBool(v)
+	case float32:
+		return o.formatFloat(float64(v), 32)
+	case float64:
+		return o.formatFloat(v, 64)
+	case int:
+		return strconv.Itoa(v)
+	case int8:
+		return strconv.FormatInt(int64(v), 10)
+	case int16:
+		return strconv.FormatInt(int64(v), 10)
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case string:
+		return o.EscapeString(v)
+	default:
+		return o.EscapeString(fmt.Sprintf("%+v", value))
+	}
+}
+
+var stringBufPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// An InvalidUTF8 mode is how escaping handles bytes that aren't valid
+// UTF-8.
+type InvalidUTF8 int
+
+const (
+	// UTF8Replace writes U+FFFD in place of each invalid byte.
+	UTF8Replace InvalidUTF8 = iota
+	// UTF8Escape writes each invalid byte as \xHH.
+	UTF8Escape
+	// UTF8Strip drops invalid bytes.
+	UTF8Strip
+)
+
+// EscapeString renders s as a logfmt value, quoting and escaping it
+// only if needed, with the default Options.
+func EscapeString(s string) string {
+	return Options{}.EscapeString(s)
+}
+
+// QuoteString is EscapeString but always quotes the result.
+func QuoteString(s string) string {
+	return Options{}.QuoteString(s)
+}
+
+// EscapeString renders s as a logfmt value, quoting and escaping it
+// only if needed.
+func (o Options) EscapeString(s string) string {
+	return escape(s, false, o.quote(), o.InvalidUTF8)
+}
+
+// QuoteString is EscapeString but always quotes the result.
+func (o Options) QuoteString(s string) string {
+	return escape(s, true, o.quote(), o.InvalidUTF8)
+}
+
+// plainBytes marks the ASCII bytes that never need quoting or
+// escaping, other than the quote character. Bytes from 0x80 up are
+// left unmarked so that values holding them take the slower path,
+// which validates UTF-8.
+var plainBytes = plainByteTable()
+
+func plainByteTable() (t [256]bool) {
+	for b := '!'; b <= '~'; b++ {
+		t[b] = b != '=' && b != '\\'
+	}
+	return t
+}
+
+// isPlain reports whether s is made up only of plainBytes other than
+// the quote character q, and so can be written as is. This is
+// byte-at-a-time over a table, much cheaper than decoding runes, and
+// covers most keys and values in practice.
+func isPlain(s string, q byte) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; !plainBytes[c] || c == q {
+			return false
+		}
+	}
+	return true
+}
+
+// escape renders s as a logfmt value quoted with quoteChar, writing
+// invalid UTF-8 as invalidUTF8 says.
+func escape(s string, forceQuotes bool, quoteChar byte, invalidUTF8 InvalidUTF8) string {
+	if !forceQuotes && isPlain(s, quoteChar) {
+		return s
+	}
+
+	needsQuotes := forceQuotes
+	needsEscape := false
+	// needsRewrite is set for invalid UTF-8 that is replaced or
+	// stripped, which changes the value without adding escapes.
+	needsRewrite := false
+	for i, r := range s {
+		if r <= ' ' || r == '=' || r == rune(quoteChar) {
+			needsQuotes = true
+		}
+		if r == '\\' || r == rune(quoteChar) || isControl(r) {
+			needsEscape = true
+		}
+		if r == utf8.RuneError {
+			if _, size := utf8.DecodeRuneInString(s[i:]); size == 1 {
+				if invalidUTF8 == UTF8Escape {
+					needsEscape = true
+				} else {
+					needsRewrite = true
+				}
+			}
+		}
+	}
+	// many logfmt parsers only interpret backslash escapes inside
+	// quotes, so never emit an escaped value unquoted.
+	if needsEscape {
+		needsQuotes = true
+	}
+	if !needsQuotes && !needsRewrite {
+		return s
+	}
+	e := stringBufPool.Get().(*bytes.Buffer)
+	e.Grow(len(s) + 2)
+	e.WriteByte(quoteChar)
+	// runs of bytes that need no escaping are copied in one write
+	// rather than rune by rune
+	plain := 0
+	for i, r := range s {
+		if r != '\\' && r != rune(quoteChar) && r != utf8.RuneError && !isControl(r) {
+			continue
+		}
+		e.WriteString(s[plain:i])
+		_, size := utf8.DecodeRuneInString(s[i:])
+		plain = i + size
+		switch r {
+		case utf8.RuneError:
+			if size == 1 {
+				switch invalidUTF8 {
+				case UTF8Escape:
+					writeHexEscape(e, s[i])
+				case UTF8Replace:
+					e.WriteRune(r)
+				}
+			} else {
+				e.WriteRune(r)
+			}
+		case '\\', rune(quoteChar):
+			e.WriteByte('\\')
+			e.WriteByte(byte(r))
+		case '\n':
+			e.WriteString("\\n")
+		case '\r':
+			e.WriteString("\\r")
+		case '\t':
+			e.WriteString("\\t")
+		default:
+			// never write raw control characters such as NUL, they
+			// break line oriented consumers
+			writeHexEscape(e, byte(r))
+		}
+	}
+	e.WriteString(s[plain:])
+	e.WriteByte(quoteChar)
+	var ret string
+	if needsQuotes {
+		ret = e.String()
+	} else {
+		ret = string(e.Bytes()[1 : e.Len()-1])
+	}
+	e.Reset()
+	stringBufPool.Put(e)
+	return ret
+}
+
+// writeHexEscape writes c to e as \xHH.
+func writeHexEscape(e *bytes.Buffer, c byte) {
+	const hex = "0123456789abcdef"
+	e.WriteString(`\x`)
+	e.WriteByte(hex[c>>4])
+	e.WriteByte(hex[c&0xf])
+}
+
+func isControl(r rune) bool {
+	return r < ' ' || r == 0x7f
+}
+
+const (
+	timeFormat = "2006-01-02T15:04:05-0700"
+
+	defaultFloatFormat    = 'f'
+	defaultFloatPrecision = 3
+)
+
+func formatShared(value interface{}) (result interface{}) {
+	defer func() {
+		if err := recover(); err != nil {
+			if v := reflect.ValueOf(value); v.Kind() == reflect.Ptr && v.IsNil() {
+				result = "nil"
+			} else {
+				panic(err)
+			}
+		}
+	}()
+
+	switch v := value.(type) {
+	case time.Time:
+		return v.Format(timeFormat)
+
+	case error:
+		return v.Error()
+
+	case fmt.Stringer:
+		return v.String()
+
+	default:
+		return v
+	}
+}
+
+// PlainValue renders a value without logfmt quoting, for embedding in
+// a larger string.
+func PlainValue(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case []interface{}:
+		return arrayText(t)
+	}
+	return fmt.Sprintf("%v", formatShared(v))
+}
+
+// arrayText renders an array as [a,b,c], with elements as PlainValue
+// renders them and null elements as nil.
+func arrayText(arr []interface{}) string {
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, elem := range arr {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		if elem == nil {
+			b.WriteString("nil")
+		} else {
+			b.WriteString(PlainValue(elem))
+		}
+	}
+	b.WriteByte(']')
+	return b.String()
+}
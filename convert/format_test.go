@@ -0,0 +1,289 @@
+package convert
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+type stringer string
+
+func (s stringer) String() string { return string(s) }
+
+func TestFormatValueEquals(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"string", "a=b", `"a=b"`},
+		{"leading", "=b", `"=b"`},
+		{"trailing", "a=", `"a="`},
+		{"json number", json.Number("a=b"), `"a=b"`},
+		{"stringer", stringer("a=b"), `"a=b"`},
+		{"struct", struct{ A string }{"b=c"}, `"{A:b=c}"`},
+		{"array", []interface{}{"a=b"}, `"[a=b]"`},
+		{"byte slice", []byte("a=b"), `"[97 61 98]"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatValue("k", tt.value); got != tt.want {
+				t.Errorf("FormatValue(%#v) = %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatRecordEquals(t *testing.T) {
+	rec := map[string]interface{}{"a=b": "c=d", "msg": "x=y"}
+	if got, want := ConvertRecord(rec), `msg="x=y" a_b="c=d"`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestEscapeInvalidUTF8(t *testing.T) {
+	tests := []struct {
+		mode InvalidUTF8
+		in   string
+		want string
+	}{
+		{UTF8Replace, "a\xff\xfeb", "a��b"},
+		{UTF8Escape, "a\xff\xfeb", `"a\xff\xfeb"`},
+		{UTF8Strip, "a\xff\xfeb", "ab"},
+		{UTF8Replace, "\xff\xfe x", "\"�� x\""},
+		{UTF8Escape, "\xff\xfe x", `"\xff\xfe x"`},
+		{UTF8Strip, "\xff\xfe x", `" x"`},
+		// a literal U+FFFD in the input is valid UTF-8 and kept as is
+		{UTF8Escape, "�", "�"},
+		{UTF8Strip, "�\xff", "�"},
+		// a truncated multibyte sequence is invalid byte by byte
+		{UTF8Escape, "\xe6\x97", `"\xe6\x97"`},
+	}
+	for _, tt := range tests {
+		opts := Options{InvalidUTF8: tt.mode}
+		got := opts.EscapeString(tt.in)
+		if got != tt.want {
+			t.Errorf("mode %d: EscapeString(%q) = %q, want %q", tt.mode, tt.in, got, tt.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("mode %d: EscapeString(%q) = %q is not valid UTF-8", tt.mode, tt.in, got)
+		}
+	}
+}
+
+func TestEscapeNUL(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"\x00", `"\x00"`},
+		{"a\x00b", `"a\x00b"`},
+		{"\x00\x01\x1f\x7f", `"\x00\x01\x1f\x7f"`},
+		{"a b\x00", `"a b\x00"`},
+	}
+	for _, tt := range tests {
+		got := EscapeString(tt.in)
+		if got != tt.want {
+			t.Errorf("EscapeString(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+		if strings.IndexByte(got, 0) >= 0 {
+			t.Errorf("EscapeString(%q) = %q holds a raw NUL", tt.in, got)
+		}
+	}
+	if got := FormatKey("a\x00b"); got != "a_b" {
+		t.Errorf("FormatKey with NUL = %q, want a_b", got)
+	}
+}
+
+func TestEscapeForcesQuotes(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{`C:\path`, `"C:\\path"`},
+		{`\\server\share`, `"\\\\server\\share"`},
+		{"a\tb", `"a\tb"`},
+		{"\t", `"\t"`},
+		{"line\nnext", `"line\nnext"`},
+		{"cr\r", `"cr\r"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{`x"y`, `"x\"y"`},
+		{"plain", "plain"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := EscapeString(tt.in); got != tt.want {
+			t.Errorf("EscapeString(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSingleQuoteChar(t *testing.T) {
+	opts := Options{QuoteChar: '\''}
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{`it's "fine"`, `'it\'s "fine"'`},
+		{`say "hi"`, `'say "hi"'`},
+		{`"quoted"`, `"quoted"`},
+		{"don't", `'don\'t'`},
+		{`a\b`, `'a\\b'`},
+		{"a b", "'a b'"},
+		{"plain", "plain"},
+	}
+	for _, tt := range tests {
+		if got := opts.EscapeString(tt.in); got != tt.want {
+			t.Errorf("EscapeString(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+
+	if got, want := opts.QuoteString(`"x"`), `'"x"'`; got != want {
+		t.Errorf("QuoteString = %s, want %s", got, want)
+	}
+	if got, want := opts.FormatKey(`it's`), "it_s"; got != want {
+		t.Errorf("FormatKey = %s, want %s", got, want)
+	}
+	if got, want := opts.FormatKey(`say"`), `say"`; got != want {
+		t.Errorf("FormatKey = %s, want %s", got, want)
+	}
+}
+
+func TestSingleQuoteRoundTrip(t *testing.T) {
+	const line = `msg='it\'s "fine"' path='C:\\dir' n=1`
+	rec, _, err := parseLogfmtLine([]byte(line), '\'')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rec["msg"], `it's "fine"`; got != want {
+		t.Errorf("msg = %q, want %q", got, want)
+	}
+	if got, want := rec["path"], `C:\dir`; got != want {
+		t.Errorf("path = %q, want %q", got, want)
+	}
+	if got, want := FormatRecord(rec, Options{QuoteChar: '\''}), `msg='it\'s "fine"' n=1 path='C:\\dir'`; got != want {
+		t.Errorf("FormatRecord = %s, want %s", got, want)
+	}
+}
+
+// benchValues are typical log keys and values: mostly plain, with some
+// needing quotes or escapes.
+var benchValues = []string{
+	"info", "request completed", "GET", "/api/v1/users/42", "200",
+	"2024-03-10T12:00:00.123Z", "ab12cd34-ef56-7890-abcd-ef1234567890",
+	"10.0.0.1:443", "user@example.com", "http.request.method",
+	`error: "timeout"`, "C:\\temp", "a=b", "naïve", "line\nbreak",
+}
+
+// runeScanPlain is isPlain written as a rune by rune scan, the way
+// escape examines values that aren't plain, to benchmark the table
+// against and to check that both agree.
+func runeScanPlain(s string, q byte) bool {
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == rune(q) || r == '\\' || isControl(r) || r >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+func TestIsPlainMatchesRuneScan(t *testing.T) {
+	inputs := append([]string{"", "~", "\x7f", "\xff", "é", "a'b"}, benchValues...)
+	for _, q := range []byte{'"', '\''} {
+		for _, s := range inputs {
+			if got, want := isPlain(s, q), runeScanPlain(s, q); got != want {
+				t.Errorf("isPlain(%q, %q) = %t, rune scan says %t", s, q, got, want)
+			}
+		}
+	}
+}
+
+func BenchmarkIsPlain(b *testing.B) {
+	b.Run("table", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, s := range benchValues {
+				isPlain(s, '"')
+			}
+		}
+	})
+	b.Run("runes", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, s := range benchValues {
+				runeScanPlain(s, '"')
+			}
+		}
+	})
+}
+
+func BenchmarkEscapeString(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, s := range benchValues {
+			EscapeString(s)
+		}
+	}
+}
+
+func TestNumberPrecision(t *testing.T) {
+	const input = `{"lat":51.50735093,"n":1234567890123456789,"e":1.5e3,"neg":-0.00049,"s":"0.123456"}`
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{
+			name: "verbatim by default",
+			opts: Options{FloatFormat: 'f', FloatPrecision: 3},
+			want: `e=1.5e3 lat=51.50735093 n=1234567890123456789 neg=-0.00049 s=0.123456`,
+		},
+		{
+			name: "precision",
+			opts: Options{FloatFormat: 'f', FloatPrecision: 2, NumberPrecision: true},
+			want: `e=1500.00 lat=51.51 n=1234567890123456789 neg=-0.00 s=0.123456`,
+		},
+		{
+			name: "shortest",
+			opts: Options{FloatFormat: 'f', FloatPrecision: -1, NumberPrecision: true},
+			want: `e=1500 lat=51.50735093 n=1234567890123456789 neg=-0.00049 s=0.123456`,
+		},
+		{
+			name: "default float format",
+			opts: Options{NumberPrecision: true},
+			want: `e=1500.000 lat=51.507 n=1234567890123456789 neg=-0.000 s=0.123456`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, err := NewDecoder(strings.NewReader(input), RecordOptions{}).Decode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := FormatRecord(rec, tt.opts); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatArray(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"strings", []interface{}{"a", "b", "c"}, `[a,b,c]`},
+		{"numbers and bools", []interface{}{json.Number("1"), json.Number("2.5"), true}, `[1,2.5,true]`},
+		{"empty", []interface{}{}, `[]`},
+		{"null element", []interface{}{"a", nil}, `[a,nil]`},
+		{"nested", []interface{}{[]interface{}{"a", "b"}, "c"}, `[[a,b],c]`},
+		{"quoted for spaces", []interface{}{"a b", "c"}, `"[a b,c]"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatValue("k", tt.value); got != tt.want {
+				t.Errorf("FormatValue(%#v) = %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
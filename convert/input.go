@@ -0,0 +1,537 @@
+package convert
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// RecordOptions controls how JSON records are decoded from an input
+// stream.
+type RecordOptions struct {
+	// SkipErrors decodes one record per line and skips lines that
+	// aren't valid JSON objects instead of stopping.
+	SkipErrors bool
+
+	// TextAs decodes one record per line and wraps lines that aren't
+	// JSON objects as a record holding the line under this key.
+	TextAs string
+
+	// Framing is how records are delimited in the input: "none" (or
+	// empty) for any whitespace between JSON values, "newline" for
+	// exactly one record per line or "rs" for RFC 7464 JSON text
+	// sequences, where each record is preceded by a 0x1e byte.
+	Framing string
+
+	// Root is a JSON pointer to the records within each input document.
+	// An array there is read as a stream of records and an object as a
+	// single record. Root is incompatible with line at a time decoding.
+	Root []string
+
+	// Docker unwraps Docker json-file log entries, decoding the
+	// application's log line as the record. See dockerReader.
+	Docker bool
+
+	// Logfmt decodes one logfmt record per line instead of JSON, for
+	// converting logfmt back to JSON.
+	Logfmt bool
+
+	// QuoteChar is the character quoting logfmt values, as for
+	// Options.QuoteChar. If zero, " is used.
+	QuoteChar byte
+
+	// PreserveOrder tracks the order of each JSON record's top level
+	// keys, returned by Decoder.Keys. It applies to the streaming and
+	// line at a time JSON decoders; with Root, Docker or Logfmt Keys
+	// returns nil.
+	PreserveOrder bool
+
+	// Workers, if more than 1, decodes this many lines at a time on
+	// separate goroutines, returning records in input order. It
+	// applies to line at a time decoding only. The goroutines exit at
+	// the end of the input or after a read error, so stopping early
+	// leaves them blocked.
+	Workers int
+}
+
+// recordSeparator is the byte preceding each record in an RFC 7464
+// JSON text sequence.
+const recordSeparator = 0x1e
+
+// newRecordReader returns the RecordReader for opts, unwrapping Docker
+// log entries if requested.
+func newRecordReader(r io.Reader, opts RecordOptions) RecordReader {
+	rr := newDecodingReader(r, opts)
+	if opts.Docker {
+		return &dockerReader{r: rr}
+	}
+	return rr
+}
+
+// newDecodingReader returns the RecordReader matching opts: line at a
+// time decoding if invalid input may be tolerated, newline framing was
+// requested or the input is logfmt, otherwise a streaming decoder
+// which also accepts records spanning lines.
+func newDecodingReader(r io.Reader, opts RecordOptions) RecordReader {
+	if opts.Framing == "rs" {
+		r = &rsStripper{r: r}
+	}
+	if opts.Root != nil {
+		return newRootReader(r, opts.Root)
+	}
+	if opts.SkipErrors || opts.TextAs != "" || opts.Framing == "newline" || opts.Logfmt {
+		lr := newLineReader(r)
+		lr.textAs = opts.TextAs
+		lr.logfmt = opts.Logfmt
+		lr.quote = Options{QuoteChar: opts.QuoteChar}.quote()
+		lr.keepOrder = opts.PreserveOrder
+		if opts.Workers > 1 {
+			return newParallelReader(lr, opts.Workers)
+		}
+		return lr
+	}
+	sr := newStreamReader(r)
+	sr.keepOrder = opts.PreserveOrder
+	return sr
+}
+
+// A Decoder reads JSON records from an input stream.
+type Decoder struct {
+	r RecordReader
+}
+
+// NewDecoder returns a Decoder reading records from r as configured by
+// opts.
+func NewDecoder(r io.Reader, opts RecordOptions) *Decoder {
+	return &Decoder{r: newRecordReader(r, opts)}
+}
+
+// Decode returns the next record, or io.EOF at the end of the input.
+// Numbers are decoded as json.Number. Decoding can continue after a
+// *LineError but not after other errors.
+func (d *Decoder) Decode() (map[string]interface{}, error) {
+	return d.r.Next()
+}
+
+// Line returns the input line on which the record last returned by
+// Decode started.
+func (d *Decoder) Line() int {
+	return d.r.Line()
+}
+
+// Keys returns the top level keys of the record last returned by
+// Decode in the order they appear in the input, if
+// RecordOptions.PreserveOrder is set and the decoder supports it, or
+// otherwise nil. A key given more than once is listed at its first
+// position.
+func (d *Decoder) Keys() []string {
+	if k, ok := d.r.(KeyOrderer); ok {
+		return k.Keys()
+	}
+	return nil
+}
+
+// KeyOrderer is implemented by the RecordReaders that can report the
+// input order of a record's keys, as for Decoder.Keys.
+type KeyOrderer interface {
+	Keys() []string
+}
+
+// RecordReader yields decoded records from one or more inputs. It is
+// what a Decoder reads from, and lets programs combining several
+// inputs, such as the logfmt command, treat them as one stream.
+type RecordReader interface {
+	// Next returns the next record, or io.EOF at the end of the
+	// input, as for Decoder.Decode.
+	Next() (map[string]interface{}, error)
+
+	// Line returns the input line on which the record last returned
+	// by Next started.
+	Line() int
+}
+
+// streamReader decodes a stream of JSON values. Records may span
+// multiple lines but a syntax error is fatal since the decoder cannot
+// resynchronize. A top level array, as written by many export tools,
+// is read as a stream of its elements.
+type streamReader struct {
+	dec   *json.Decoder
+	lines *newlineCounter
+	line  int
+	// inArray is set between the brackets of a top level array.
+	inArray bool
+
+	// keepOrder records the order of each record's keys in keys.
+	keepOrder bool
+	keys      []string
+}
+
+func newStreamReader(r io.Reader) *streamReader {
+	lines := &newlineCounter{r: r}
+	dec := json.NewDecoder(lines)
+	dec.UseNumber()
+	return &streamReader{dec: dec, lines: lines}
+}
+
+func (r *streamReader) Next() (map[string]interface{}, error) {
+	if err := r.enterArray(); err != nil {
+		return nil, err
+	}
+
+	var rec map[string]interface{}
+	// More skips the whitespace before the next value, so the offset
+	// is that of the value itself.
+	r.dec.More()
+	start := r.dec.InputOffset()
+	if r.inArray {
+		// within an array the offset is still before the comma
+		_, skipped := nextValue(r.dec.Buffered())
+		start += skipped
+	}
+	r.line = r.lines.lineAt(start)
+	var err error
+	if r.keepOrder {
+		rec, r.keys, err = r.decodeOrdered()
+	} else {
+		err = r.dec.Decode(&rec)
+	}
+	if err != nil && err != io.EOF {
+		offset := r.dec.InputOffset()
+		if o := jsonErrorOffset(err); o > 0 {
+			offset = o
+		}
+		if _, ok := err.(*json.UnmarshalTypeError); ok {
+			offset = start
+		}
+		return nil, &OffsetError{Offset: offset, Err: err}
+	}
+	return rec, err
+}
+
+func (r *streamReader) Line() int {
+	return r.line
+}
+
+func (r *streamReader) Keys() []string {
+	return r.keys
+}
+
+// decodeOrdered decodes the next value as a record along with the
+// order of its keys. The value is read whole first, so a syntax error
+// is reported just as Decode would.
+func (r *streamReader) decodeOrdered() (map[string]interface{}, []string, error) {
+	var raw json.RawMessage
+	if err := r.dec.Decode(&raw); err != nil {
+		return nil, nil, err
+	}
+	return decodeObject(raw)
+}
+
+// decodeObject decodes raw, a valid JSON value, as a record and returns
+// it with the order of its top level keys.
+func decodeObject(raw []byte) (map[string]interface{}, []string, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var rec map[string]interface{}
+	if err := dec.Decode(&rec); err != nil {
+		return nil, nil, err
+	}
+	return rec, objectKeys(raw, len(rec)), nil
+}
+
+// objectKeys returns the top level keys of the JSON object raw in
+// order, dropping repeats. n is the number of distinct keys.
+func objectKeys(raw []byte, n int) []string {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if _, err := dec.Token(); err != nil {
+		return nil
+	}
+	keys := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil
+		}
+		key, _ := tok.(string)
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return nil
+		}
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// enterArray moves past the brackets of top level arrays so that the
+// next value decoded is a record: it consumes the closing bracket of
+// an array with no elements left and the opening one of an array
+// coming next.
+func (r *streamReader) enterArray() error {
+	for {
+		more := r.dec.More()
+		if r.inArray {
+			if more {
+				return nil
+			}
+			r.inArray = false
+		} else if c, _ := nextValue(r.dec.Buffered()); !more || c != '[' {
+			return nil
+		} else {
+			r.inArray = true
+		}
+		if _, err := r.dec.Token(); err != nil {
+			return &OffsetError{Offset: r.dec.InputOffset(), Err: err}
+		}
+	}
+}
+
+// nextValue returns the first byte of the next value in the
+// decoder's buffered input, which More has filled, and how many
+// bytes of whitespace and array separator precede it.
+func nextValue(buf io.Reader) (byte, int64) {
+	var b [1]byte
+	var skipped int64
+	for {
+		if n, _ := buf.Read(b[:]); n == 0 {
+			return 0, skipped
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n', ',':
+			skipped++
+			continue
+		}
+		return b[0], skipped
+	}
+}
+
+// newlineCounter records the offsets of the newlines read through it
+// so that decoder offsets can be mapped to line numbers.
+type newlineCounter struct {
+	r      io.Reader
+	offset int64
+	// newlines holds the offsets of newlines not yet passed by
+	// lineAt; before counts those already passed.
+	newlines []int64
+	before   int
+}
+
+func (c *newlineCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	for i, b := range p[:n] {
+		if b == '\n' {
+			c.newlines = append(c.newlines, c.offset+int64(i))
+		}
+	}
+	c.offset += int64(n)
+	return n, err
+}
+
+// lineAt returns the 1-based line holding the byte at offset. Offsets
+// must not decrease between calls.
+func (c *newlineCounter) lineAt(offset int64) int {
+	i := 0
+	for i < len(c.newlines) && c.newlines[i] < offset {
+		i++
+	}
+	c.before += i
+	c.newlines = c.newlines[i:]
+	return c.before + 1
+}
+
+// rsStripper drops the record separators from a JSON text sequence,
+// leaving JSON values separated by newlines. A 0x1e byte can't appear
+// unescaped inside a valid JSON value, so every one is a separator.
+// Error offsets are counted after the separators are removed.
+type rsStripper struct {
+	r io.Reader
+}
+
+func (s *rsStripper) Read(p []byte) (int, error) {
+	for {
+		n, err := s.r.Read(p)
+		out := 0
+		for _, b := range p[:n] {
+			if b != recordSeparator {
+				p[out] = b
+				out++
+			}
+		}
+		// keep reading if only separators were read, so that callers
+		// don't see a spurious empty read
+		if out > 0 || n == 0 || err != nil {
+			return out, err
+		}
+	}
+}
+
+// OffsetError is a decode error from the stream decoder, which can't
+// continue past it. Offset is the byte offset of the error in the
+// input stream.
+type OffsetError struct {
+	Offset int64
+	Err    error
+}
+
+func (e *OffsetError) Error() string {
+	return fmt.Sprintf("offset %d: %s", e.Offset, e.Err)
+}
+
+func (e *OffsetError) Unwrap() error {
+	return e.Err
+}
+
+// lineReader decodes one JSON record per line. Invalid lines are
+// reported as a *LineError and reading may continue past them.
+type lineReader struct {
+	r    *bufio.Reader
+	line int
+	// offset is the byte offset of the start of the next line.
+	offset int64
+
+	// textAs, if set, turns lines that aren't JSON objects into a
+	// record holding the raw line under this key instead of an error.
+	textAs string
+
+	// logfmt decodes each line as logfmt instead of JSON, with values
+	// quoted by quote.
+	logfmt bool
+	quote  byte
+
+	// keepOrder records the order of each record's keys in keys.
+	keepOrder bool
+	keys      []string
+}
+
+func newLineReader(r io.Reader) *lineReader {
+	return &lineReader{r: bufio.NewReader(r)}
+}
+
+// LineError is returned for a line that could not be decoded when
+// decoding one record per line. Decoding may continue past it.
+type LineError struct {
+	Line int
+	// Offset is the byte offset of the error in the input stream.
+	Offset int64
+	Raw    []byte
+	Err    error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d (offset %d): %s", e.Line, e.Offset, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// jsonErrorOffset returns how far into its input the decoder got
+// before err, if known.
+func jsonErrorOffset(err error) int64 {
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		return e.Offset
+	case *json.UnmarshalTypeError:
+		return e.Offset
+	}
+	return 0
+}
+
+var errTrailingData = errors.New("invalid trailing data after JSON object")
+
+func (r *lineReader) Next() (map[string]interface{}, error) {
+	line, offset, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	var rec map[string]interface{}
+	rec, r.keys, err = r.decode(line, r.line, offset)
+	return rec, err
+}
+
+func (r *lineReader) Keys() []string {
+	return r.keys
+}
+
+// readLine returns the next line that isn't blank, without its line
+// ending, and the offset it starts at. r.line is its line number.
+func (r *lineReader) readLine() ([]byte, int64, error) {
+	for {
+		line, err := r.r.ReadBytes('\n')
+		if len(line) == 0 && err != nil {
+			return nil, 0, err
+		}
+		if err != nil && err != io.EOF {
+			return nil, 0, err
+		}
+		r.line++
+		lineOffset := r.offset
+		r.offset += int64(len(line))
+
+		line = bytes.TrimSuffix(line, []byte("\n"))
+		// tolerate CRLF line endings from Windows producers
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		return line, lineOffset, nil
+	}
+}
+
+// decode decodes one line, number n starting at offset, returning the
+// order of its keys with keepOrder. It only reads the reader's
+// settings, so lines may be decoded concurrently.
+func (r *lineReader) decode(line []byte, n int, offset int64) (map[string]interface{}, []string, error) {
+	var rec map[string]interface{}
+	var errOffset int64
+	var err error
+	if r.logfmt {
+		rec, errOffset, err = parseLogfmtLine(line, r.quote)
+	} else {
+		rec, errOffset, err = decodeJSONLine(line)
+	}
+	if err != nil {
+		if r.textAs != "" {
+			return map[string]interface{}{r.textAs: string(line)}, []string{r.textAs}, nil
+		}
+		return nil, nil, &LineError{Line: n, Offset: offset + errOffset, Raw: line, Err: err}
+	}
+	if r.keepOrder && !r.logfmt {
+		return rec, objectKeys(line, len(rec)), nil
+	}
+	return rec, nil, nil
+}
+
+// DecodeRecord decodes b as a single JSON object, with numbers as
+// json.Number like Decoder. JSON null decodes as a nil record. Data
+// after the object other than whitespace is an error.
+func DecodeRecord(b []byte) (map[string]interface{}, error) {
+	rec, _, err := decodeJSONLine(b)
+	return rec, err
+}
+
+// decodeJSONLine decodes line as a single JSON object. On error it
+// also returns how far into line the decoder got.
+func decodeJSONLine(line []byte) (map[string]interface{}, int64, error) {
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	var rec map[string]interface{}
+	err := dec.Decode(&rec)
+	if err == nil && dec.More() {
+		err = errTrailingData
+	}
+	if err != nil {
+		return nil, jsonErrorOffset(err), err
+	}
+	return rec, 0, nil
+}
+
+func (r *lineReader) Line() int {
+	return r.line
+}
@@ -0,0 +1,166 @@
+package convert
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// decodeAll formats every record of input with ConvertRecord, one per
+// line, along with the line numbers the decoder reports.
+func decodeAll(t *testing.T, input string, opts RecordOptions) string {
+	t.Helper()
+	dec := NewDecoder(strings.NewReader(input), opts)
+	var b strings.Builder
+	for {
+		rec, err := dec.Decode()
+		if err == io.EOF {
+			return b.String()
+		}
+		if _, ok := err.(*LineError); ok && opts.SkipErrors {
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.WriteString(ConvertRecord(rec))
+		b.WriteByte(' ')
+		b.WriteString(strings.Repeat("+", dec.Line()))
+		b.WriteByte('\n')
+	}
+}
+
+func TestCRLF(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		opts  RecordOptions
+	}{
+		{
+			name:  "stream",
+			input: `{"msg":"a","n":1}` + "\n" + `{"msg":"b c","n":2}` + "\n",
+		},
+		{
+			name:  "stream record spanning lines",
+			input: "{\n\"msg\": \"a\",\n\"n\": 1\n}\n" + `{"msg":"b"}` + "\n",
+		},
+		{
+			name:  "newline framing",
+			input: `{"msg":"a"}` + "\n\n" + `{"msg":"b","n":2}` + "\n",
+			opts:  RecordOptions{Framing: "newline"},
+		},
+		{
+			name:  "skip errors",
+			input: `{"msg":"a"}` + "\nnot json\n" + `{"msg":"last"}`,
+			opts:  RecordOptions{SkipErrors: true},
+		},
+		{
+			name:  "text as",
+			input: `{"msg":"a"}` + "\nplain text\n",
+			opts:  RecordOptions{TextAs: "line"},
+		},
+		{
+			name:  "logfmt",
+			input: "msg=a n=1\nmsg=\"b c\"\n",
+			opts:  RecordOptions{Logfmt: true},
+		},
+		{
+			name:  "parallel",
+			input: `{"msg":"a"}` + "\n" + `{"msg":"b"}` + "\n" + `{"msg":"c"}` + "\n",
+			opts:  RecordOptions{Framing: "newline", Workers: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lf := decodeAll(t, tt.input, tt.opts)
+			crlf := decodeAll(t, strings.ReplaceAll(tt.input, "\n", "\r\n"), tt.opts)
+			if crlf != lf {
+				t.Errorf("CRLF input gave\n%s\nLF input gave\n%s", crlf, lf)
+			}
+			if strings.Contains(crlf, "\r") {
+				t.Errorf("CR left in output %q", crlf)
+			}
+		})
+	}
+}
+
+func TestDecodeRecord(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{in: `{"a":1.50,"b":"x"}`, want: map[string]interface{}{"a": json.Number("1.50"), "b": "x"}},
+		{in: "{\"a\":1}\n", want: map[string]interface{}{"a": json.Number("1")}},
+		{in: `null`, want: nil},
+		{in: `{"a":1} {"b":2}`, wantErr: true},
+		{in: `[1]`, wantErr: true},
+		{in: `{"a":`, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := DecodeRecord([]byte(tt.in))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("DecodeRecord(%q) error %v, want error %t", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("DecodeRecord(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTopLevelArray(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		opts  RecordOptions
+		want  string
+	}{
+		{
+			name:  "array of records",
+			input: `[{"msg":"a"},{"msg":"b"}]`,
+			want:  "msg=a +\nmsg=b +\n",
+		},
+		{
+			name:  "array spanning lines",
+			input: "[\n  {\"msg\": \"a\"},\n  {\"msg\": \"b\"}\n]\n",
+			want:  "msg=a ++\nmsg=b +++\n",
+		},
+		{
+			name:  "empty array",
+			input: "[]\n",
+			want:  "",
+		},
+		{
+			name:  "arrays and records mixed",
+			input: "[{\"n\":1}]\n{\"n\":2}\n[]\n[{\"n\":3},\n{\"n\":4}]\n",
+			want:  "n=1 +\nn=2 ++\nn=3 ++++\nn=4 +++++\n",
+		},
+		{
+			name:  "preserve order",
+			input: `[{"msg":"a","b":1,"a":2}]`,
+			opts:  RecordOptions{PreserveOrder: true},
+			want:  "msg=a a=2 b=1 +\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeAll(t, tt.input, tt.opts); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTopLevelArrayNonRecord(t *testing.T) {
+	dec := NewDecoder(strings.NewReader(`[{"msg":"a"},[1,2]]`), RecordOptions{})
+	if _, err := dec.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dec.Decode(); err == nil || err == io.EOF {
+		t.Errorf("nested array element decoded without an error: %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package convert
+
+import "strings"
+
+// KeyOrder orders record keys as the logfmt command's -order does: the
+// keys in Head first, by their position there, then every other key,
+// then the keys in Tail by their position there. Positions only need
+// to be increasing. Unlisted keys are compared bytewise, or with
+// NaturalLess if Natural is set.
+type KeyOrder struct {
+	Head    map[string]int
+	Tail    map[string]int
+	Natural bool
+}
+
+// defaultKeyOrder puts time and msg first, the command's default -order.
+var defaultKeyOrder = KeyOrder{Head: map[string]int{"time": 0, "msg": 1}}
+
+// Rank returns which section of the line key belongs to (0 for the
+// head, 1 for the unlisted middle, 2 for the tail) and its position
+// within that section.
+func (o KeyOrder) Rank(key string) (section, idx int) {
+	if i, ok := o.Head[key]; ok {
+		return 0, i
+	}
+	if i, ok := o.Tail[key]; ok {
+		return 2, i
+	}
+	return 1, 0
+}
+
+// Less reports whether key a is written before key b, for use as
+// Options.KeyLess.
+func (o KeyOrder) Less(a, b string) bool {
+	sectionA, idxA := o.Rank(a)
+	sectionB, idxB := o.Rank(b)
+
+	if sectionA != sectionB {
+		return sectionA < sectionB
+	}
+	if sectionA != 1 {
+		return idxA < idxB
+	}
+
+	if o.Natural {
+		return NaturalLess(a, b)
+	}
+	return a < b
+}
+
+// NaturalLess compares strings treating runs of digits as numbers, so
+// item2 comes before item10.
+func NaturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		da, db := digitPrefix(a), digitPrefix(b)
+		if da > 0 && db > 0 {
+			na, nb := strings.TrimLeft(a[:da], "0"), strings.TrimLeft(b[:db], "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			if da != db {
+				// same value, fewer leading zeros first
+				return da < db
+			}
+			a, b = a[da:], b[db:]
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+func digitPrefix(s string) int {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,74 @@
+package convert
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestKeyOrder(t *testing.T) {
+	keys := []string{"item10", "b", "msg", "item2", "Z", "level", "time", "caller"}
+
+	tests := []struct {
+		name  string
+		order KeyOrder
+		want  []string
+	}{
+		{
+			name:  "default",
+			order: defaultKeyOrder,
+			want:  []string{"time", "msg", "Z", "b", "caller", "item10", "item2", "level"},
+		},
+		{
+			name:  "natural",
+			order: KeyOrder{Head: map[string]int{"time": 0, "msg": 1}, Natural: true},
+			want:  []string{"time", "msg", "Z", "b", "caller", "item2", "item10", "level"},
+		},
+		{
+			name: "head and tail",
+			order: KeyOrder{
+				Head: map[string]int{"level": 0, "msg": 5},
+				Tail: map[string]int{"time": 1, "caller": 0},
+			},
+			want: []string{"level", "msg", "Z", "b", "item10", "item2", "caller", "time"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := append([]string(nil), keys...)
+			sort.Slice(got, func(i, j int) bool { return tt.order.Less(got[i], got[j]) })
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNaturalLess(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"item2", "item10", true},
+		{"item10", "item2", false},
+		{"a1b2", "a1b10", true},
+		{"x02", "x2", false},
+		{"x2", "x02", true},
+		{"abc", "abd", true},
+		{"ab", "abc", true},
+		{"10", "9", false},
+	}
+	for _, tt := range tests {
+		if got := NaturalLess(tt.a, tt.b); got != tt.want {
+			t.Errorf("NaturalLess(%q, %q) = %t, want %t", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestFormatRecordDefaultOrder(t *testing.T) {
+	rec := map[string]interface{}{"b": "2", "msg": "hi", "A": "1", "time": "t"}
+	if got, want := ConvertRecord(rec), "time=t msg=hi A=1 b=2"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
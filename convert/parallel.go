@@ -0,0 +1,108 @@
+package convert
+
+// parallelBatchLines is how many lines are handed to a worker at a
+// time, enough to keep the channel overhead small next to decoding.
+const parallelBatchLines = 256
+
+// parallelReader decodes the lines of a lineReader on a pool of
+// goroutines. One goroutine reads batches of lines and queues each
+// batch both for the workers and, as a future, for Next, which waits
+// on the futures in order so records come out in input order.
+type parallelReader struct {
+	futures chan chan *lineBatch
+	cur     *lineBatch
+	pos     int
+	line    int
+}
+
+// lineBatch is a run of lines and, once decoded, their records. err is
+// set on the last batch read if reading failed with something other
+// than io.EOF.
+type lineBatch struct {
+	lines   [][]byte
+	nums    []int
+	offsets []int64
+	recs    []map[string]interface{}
+	keys    [][]string
+	errs    []error
+	err     error
+
+	r    *lineReader
+	done chan *lineBatch
+}
+
+func newParallelReader(lr *lineReader, workers int) *parallelReader {
+	p := &parallelReader{futures: make(chan chan *lineBatch, workers*2)}
+	jobs := make(chan *lineBatch, workers*2)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for b := range jobs {
+				b.decode()
+			}
+		}()
+	}
+	go p.read(lr, jobs)
+	return p
+}
+
+func (p *parallelReader) read(lr *lineReader, jobs chan<- *lineBatch) {
+	defer close(p.futures)
+	defer close(jobs)
+	for {
+		b := &lineBatch{r: lr, done: make(chan *lineBatch, 1)}
+		for len(b.lines) < parallelBatchLines {
+			line, offset, err := lr.readLine()
+			if err != nil {
+				b.err = err
+				break
+			}
+			b.lines = append(b.lines, line)
+			b.nums = append(b.nums, lr.line)
+			b.offsets = append(b.offsets, offset)
+		}
+		p.futures <- b.done
+		jobs <- b
+		if b.err != nil {
+			return
+		}
+	}
+}
+
+func (b *lineBatch) decode() {
+	b.recs = make([]map[string]interface{}, len(b.lines))
+	b.keys = make([][]string, len(b.lines))
+	b.errs = make([]error, len(b.lines))
+	for i, line := range b.lines {
+		b.recs[i], b.keys[i], b.errs[i] = b.r.decode(line, b.nums[i], b.offsets[i])
+	}
+	b.done <- b
+}
+
+func (p *parallelReader) Next() (map[string]interface{}, error) {
+	for p.cur == nil || p.pos == len(p.cur.lines) {
+		if p.cur != nil && p.cur.err != nil {
+			return nil, p.cur.err
+		}
+		future, ok := <-p.futures
+		if !ok {
+			return nil, p.cur.err
+		}
+		p.cur = <-future
+		p.pos = 0
+	}
+	i := p.pos
+	p.pos++
+	p.line = p.cur.nums[i]
+	return p.cur.recs[i], p.cur.errs[i]
+}
+
+func (p *parallelReader) Line() int {
+	return p.line
+}
+
+func (p *parallelReader) Keys() []string {
+	if p.cur == nil || p.pos == 0 {
+		return nil
+	}
+	return p.cur.keys[p.pos-1]
+}
@@ -0,0 +1,49 @@
+//go:build go1.23
+
+package convert
+
+import (
+	"io"
+	"iter"
+)
+
+// Records returns an iterator over the JSON records in r, for use with
+// range-over-func:
+//
+//	for rec, err := range Records(f, RecordOptions{}) {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+//
+// gzip and zstd compressed input is decompressed, as by Decompress.
+// Iteration stops after the first error is yielded. With
+// opts.SkipErrors invalid lines are skipped rather than reported.
+func Records(r io.Reader, opts RecordOptions) iter.Seq2[map[string]interface{}, error] {
+	return func(yield func(map[string]interface{}, error) bool) {
+		dr, err := Decompress(r)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer dr.Close()
+		records := newRecordReader(dr, opts)
+		for {
+			rec, err := records.Next()
+			if err == io.EOF {
+				return
+			}
+			if _, ok := err.(*LineError); ok && opts.SkipErrors {
+				continue
+			}
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(rec, nil) {
+				return
+			}
+		}
+	}
+}
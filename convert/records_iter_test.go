@@ -0,0 +1,27 @@
+//go:build go1.23
+
+package convert
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+)
+
+func TestRecordsGzip(t *testing.T) {
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte(`{"msg":"a"}` + "\n" + `{"msg":"b"}` + "\n"))
+	gw.Close()
+
+	var got []string
+	for rec, err := range Records(&gz, RecordOptions{}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, rec["msg"].(string))
+	}
+	if len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("got %v, want [a b]", got)
+	}
+}
@@ -0,0 +1,132 @@
+package convert
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// logfmtSyntaxError describes malformed logfmt input.
+type logfmtSyntaxError struct {
+	msg string
+	// Offset is the byte offset of the error within the line.
+	Offset int
+}
+
+func (e *logfmtSyntaxError) Error() string {
+	return fmt.Sprintf("%s at column %d", e.msg, e.Offset+1)
+}
+
+// parseLogfmtLine decodes a logfmt line for -reverse: key=value pairs
+// separated by spaces, where quoted values may hold the backslash
+// escapes EscapeString writes, within the quote character quote.
+// Quoted values are always strings. Bare
+// values are typed the way an unquoted logfmt value reads: true and
+// false as booleans, nil as null and anything that is a valid JSON
+// number as a number. A key with no = is true. On error it also
+// returns the offset of the problem within line.
+func parseLogfmtLine(line []byte, quote byte) (map[string]interface{}, int64, error) {
+	rec := make(map[string]interface{})
+	i := 0
+	for {
+		for i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+			i++
+		}
+		if i == len(line) {
+			return rec, 0, nil
+		}
+
+		start := i
+		for i < len(line) && line[i] != ' ' && line[i] != '\t' && line[i] != '=' {
+			i++
+		}
+		key := string(line[start:i])
+		if key == "" {
+			return nil, int64(start), &logfmtSyntaxError{msg: "missing key", Offset: start}
+		}
+		if i == len(line) || line[i] != '=' {
+			rec[key] = true
+			continue
+		}
+		i++ // =
+
+		if i < len(line) && line[i] == quote {
+			s, end, err := unquoteLogfmt(line, i)
+			if err != nil {
+				return nil, int64(err.Offset), err
+			}
+			i = end
+			if i < len(line) && line[i] != ' ' && line[i] != '\t' {
+				return nil, int64(i), &logfmtSyntaxError{msg: "missing space after quoted value", Offset: i}
+			}
+			rec[key] = s
+			continue
+		}
+
+		start = i
+		for i < len(line) && line[i] != ' ' && line[i] != '\t' {
+			i++
+		}
+		rec[key] = bareLogfmtValue(string(line[start:i]))
+	}
+}
+
+// bareLogfmtValue types an unquoted logfmt value.
+func bareLogfmtValue(s string) interface{} {
+	switch s {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "nil":
+		return nil
+	}
+	if s != "" && json.Valid([]byte(s)) && (s[0] == '-' || (s[0] >= '0' && s[0] <= '9')) {
+		return json.Number(s)
+	}
+	return s
+}
+
+// unquoteLogfmt decodes the quoted value starting at b[start], which
+// holds the quote character, returning it and the offset just past
+// the closing quote.
+func unquoteLogfmt(b []byte, start int) (string, int, *logfmtSyntaxError) {
+	var out []byte
+	for i := start + 1; i < len(b); i++ {
+		c := b[i]
+		if c == b[start] {
+			return string(out), i + 1, nil
+		}
+		if c != '\\' {
+			out = append(out, c)
+			continue
+		}
+		i++
+		if i == len(b) {
+			break
+		}
+		switch b[i] {
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'x':
+			if i+2 >= len(b) {
+				return "", 0, &logfmtSyntaxError{msg: "truncated \\x escape", Offset: i - 1}
+			}
+			n, err := strconv.ParseUint(string(b[i+1:i+3]), 16, 8)
+			if err != nil {
+				return "", 0, &logfmtSyntaxError{msg: "invalid \\x escape", Offset: i - 1}
+			}
+			out = append(out, byte(n))
+			i += 2
+		default:
+			// \\, the quote character and anything else stand for
+			// themselves
+			out = append(out, b[i])
+		}
+	}
+	return "", 0, &logfmtSyntaxError{msg: "unterminated quoted value", Offset: start}
+}
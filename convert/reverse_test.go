@@ -0,0 +1,124 @@
+package convert
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseLogfmtLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		quote   byte
+		want    map[string]interface{}
+		wantErr int // 1-based error column, 0 for none
+	}{
+		{
+			name: "types",
+			in:   `a=1 b=-2.5e3 c=true d=false e=nil f=bare g="quoted 1"`,
+			want: map[string]interface{}{
+				"a": json.Number("1"),
+				"b": json.Number("-2.5e3"),
+				"c": true,
+				"d": false,
+				"e": nil,
+				"f": "bare",
+				"g": "quoted 1",
+			},
+		},
+		{
+			name: "quoted values stay strings",
+			in:   `n="12" t="true" z="nil"`,
+			want: map[string]interface{}{"n": "12", "t": "true", "z": "nil"},
+		},
+		{
+			name: "not quite numbers",
+			in:   `a=1. b=+1 c=0x10 d=1_000 e=.5`,
+			want: map[string]interface{}{"a": "1.", "b": "+1", "c": "0x10", "d": "1_000", "e": ".5"},
+		},
+		{
+			name: "key without value",
+			in:   "debug  msg=hi\t",
+			want: map[string]interface{}{"debug": true, "msg": "hi"},
+		},
+		{
+			name: "empty values",
+			in:   `a= b=""`,
+			want: map[string]interface{}{"a": "", "b": ""},
+		},
+		{
+			name: "escapes",
+			in:   `m="a\"b\\c\nd\te\x00\x7f"`,
+			want: map[string]interface{}{"m": "a\"b\\c\nd\te\x00\x7f"},
+		},
+		{
+			name:  "single quote char",
+			in:    `m='it\'s "x"'`,
+			quote: '\'',
+			want:  map[string]interface{}{"m": `it's "x"`},
+		},
+		{
+			name: "empty line",
+			in:   "",
+			want: map[string]interface{}{},
+		},
+		{name: "missing key", in: `a=1 =2`, wantErr: 5},
+		{name: "unterminated", in: `a="x`, wantErr: 3},
+		{name: "space after quote", in: `a="x"b=1`, wantErr: 6},
+		{name: "truncated hex escape", in: `a="\x4"`, wantErr: 4},
+		{name: "invalid hex escape", in: `a="\xzz"`, wantErr: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quote := tt.quote
+			if quote == 0 {
+				quote = '"'
+			}
+			got, _, err := parseLogfmtLine([]byte(tt.in), quote)
+			if tt.wantErr > 0 {
+				serr, ok := err.(*logfmtSyntaxError)
+				if !ok {
+					t.Fatalf("got %v, %v, want a syntax error at column %d", got, err, tt.wantErr)
+				}
+				if serr.Offset+1 != tt.wantErr {
+					t.Errorf("error %q, want column %d", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestLogfmtRoundTrip checks that -reverse reads back what FormatRecord
+// writes. Strings that look like numbers or booleans are written bare
+// and so can't round trip.
+func TestLogfmtRoundTrip(t *testing.T) {
+	rec := map[string]interface{}{
+		"msg":   "hello \"world\"\n\ttabbed",
+		"n":     json.Number("-12.5"),
+		"ok":    true,
+		"null":  nil,
+		"empty": "",
+		"eq":    "a=b",
+		"bad":   "\x01\x7f",
+		"utf8":  "名前",
+	}
+	for _, q := range []byte{'"', '\''} {
+		opts := Options{QuoteChar: q}
+		line := FormatRecord(rec, opts)
+		got, _, err := parseLogfmtLine([]byte(line), q)
+		if err != nil {
+			t.Fatalf("quote %c: %s: %v", q, line, err)
+		}
+		if !reflect.DeepEqual(got, rec) {
+			t.Errorf("quote %c: %s read back as %#v", q, line, got)
+		}
+	}
+}
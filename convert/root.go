@@ -0,0 +1,129 @@
+package convert
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ParseJSONPointer splits an RFC 6901 JSON pointer such as /data/records
+// into its unescaped reference tokens.
+func ParseJSONPointer(ptr string) ([]string, error) {
+	if ptr == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(ptr, "/") {
+		return nil, fmt.Errorf("JSON pointer %q must start with /", ptr)
+	}
+	tokens := strings.Split(ptr[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(t)
+	}
+	return tokens, nil
+}
+
+// resolveJSONPointer returns the value at path within v.
+func resolveJSONPointer(v interface{}, path []string) (interface{}, error) {
+	for i, tok := range path {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			next, ok := t[tok]
+			if !ok {
+				return nil, fmt.Errorf("no key %q at /%s", tok, strings.Join(path[:i], "/"))
+			}
+			v = next
+		case []interface{}:
+			idx, err := strconv.Atoi(tok)
+			if err != nil || idx < 0 || idx >= len(t) {
+				return nil, fmt.Errorf("no index %q at /%s", tok, strings.Join(path[:i], "/"))
+			}
+			v = t[idx]
+		default:
+			return nil, fmt.Errorf("can't descend into %T at /%s", v, strings.Join(path[:i], "/"))
+		}
+	}
+	return v, nil
+}
+
+// rootReader decodes a stream of JSON documents and yields the records
+// found at a path within each: every element of an array, or an
+// object as a single record.
+type rootReader struct {
+	dec   *json.Decoder
+	lines *newlineCounter
+	path  []string
+	line  int
+
+	// pending holds the remaining elements of the current document's
+	// array.
+	pending []interface{}
+	offset  int64
+}
+
+func newRootReader(r io.Reader, path []string) *rootReader {
+	lines := &newlineCounter{r: r}
+	dec := json.NewDecoder(lines)
+	dec.UseNumber()
+	return &rootReader{dec: dec, lines: lines, path: path}
+}
+
+func (r *rootReader) Next() (map[string]interface{}, error) {
+	for len(r.pending) == 0 {
+		var doc interface{}
+		r.dec.More()
+		r.offset = r.dec.InputOffset()
+		r.line = r.lines.lineAt(r.offset)
+		if err := r.dec.Decode(&doc); err != nil {
+			if err == io.EOF {
+				return nil, err
+			}
+			offset := r.dec.InputOffset()
+			if o := jsonErrorOffset(err); o > 0 {
+				offset = o
+			}
+			return nil, &OffsetError{Offset: offset, Err: err}
+		}
+
+		v, err := resolveJSONPointer(doc, r.path)
+		if err != nil {
+			return nil, &OffsetError{Offset: r.offset, Err: fmt.Errorf("-root: %s", err)}
+		}
+		if arr, ok := v.([]interface{}); ok {
+			r.pending = arr
+			continue
+		}
+		r.pending = []interface{}{v}
+	}
+
+	v := r.pending[0]
+	r.pending = r.pending[1:]
+	rec, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, &OffsetError{Offset: r.offset, Err: fmt.Errorf("-root: record is %s, not an object", jsonTypeName(v))}
+	}
+	return rec, nil
+}
+
+func (r *rootReader) Line() int {
+	return r.line
+}
+
+// jsonTypeName names the JSON type of a decoded value for error
+// messages.
+func jsonTypeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "a boolean"
+	case json.Number:
+		return "a number"
+	case string:
+		return "a string"
+	case []interface{}:
+		return "an array"
+	}
+	return "an object"
+}
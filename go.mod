@@ -1,3 +1,8 @@
 module github.com/psanford/logfmt
 
 go 1.16
+
+require (
+	github.com/klauspost/compress v1.15.9
+	golang.org/x/term v0.1.0
+)